@@ -2,10 +2,14 @@ package main
 
 import (
 	"net"
+	"net/http"
 
 	"github.com/PharmaKart/payment-svc/internal/handlers"
+	"github.com/PharmaKart/payment-svc/internal/policies"
 	"github.com/PharmaKart/payment-svc/internal/proto"
+	"github.com/PharmaKart/payment-svc/internal/providers"
 	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/internal/services"
 	"github.com/PharmaKart/payment-svc/pkg/config"
 	"github.com/PharmaKart/payment-svc/pkg/utils"
 	"google.golang.org/grpc"
@@ -27,8 +31,23 @@ func main() {
 		})
 	}
 
+	// Run database migrations
+	if err := utils.MigrateDB(db); err != nil {
+		utils.Logger.Fatal("Failed to migrate database", map[string]interface{}{
+			"error": err,
+		})
+	}
+
 	// Initialize repositories
 	paymentRepo := repositories.NewPaymentRepository(db)
+	refundRepo := repositories.NewRefundRepository(db)
+	refundApprovalRepo := repositories.NewRefundApprovalRepository(db)
+	webhookEventRepo := repositories.NewWebhookEventRepository(db)
+	outboxRepo := repositories.NewOutboxRepository(db)
+	idempotencyKeyRepo := repositories.NewIdempotencyKeyRepository(db)
+	checkoutSessionRepo := repositories.NewCheckoutSessionRepository(db)
+	jobRepo := repositories.NewJobRepository(db)
+	disputeRepo := repositories.NewDisputeRepository(db)
 
 	// Initialize order client
 	conn, err := grpc.NewClient(cfg.OrderServiceURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -41,10 +60,65 @@ func main() {
 	orderClient := proto.NewOrderServiceClient(conn)
 	defer conn.Close()
 
-	// Initialize stripe key
+	// Initialize payment provider
+	paymentProvider, err := providers.New(cfg)
+	if err != nil {
+		utils.Logger.Fatal("Failed to initialize payment provider", map[string]interface{}{
+			"error": err,
+		})
+	}
+
+	// Initialize prescription policy
+	prescriptionPolicy, err := policies.New(cfg)
+	if err != nil {
+		utils.Logger.Fatal("Failed to load prescription policy", map[string]interface{}{
+			"error": err,
+		})
+	}
+
+	// Initialize services
+	paymentService := services.NewPaymentService(paymentRepo, refundRepo, refundApprovalRepo, checkoutSessionRepo, &orderClient, paymentProvider, prescriptionPolicy, cfg)
+	disputeService := services.NewDisputeService(disputeRepo, paymentRepo, paymentService, paymentProvider)
+	webhookService := services.NewWebhookService(webhookEventRepo, paymentService, disputeService, cfg)
+	outboxDispatcher := services.NewOutboxDispatcher(outboxRepo, &orderClient, cfg)
+	idempotencyService := services.NewIdempotencyService(idempotencyKeyRepo)
+	authorizationMonitor := services.NewAuthorizationMonitor(paymentRepo, cfg)
+	pendingPaymentSweeper := services.NewPendingPaymentSweeper(paymentRepo, paymentService, cfg)
 
 	// Initialize handlers
-	paymentHandler := handlers.NewPaymentHandler(paymentRepo, &orderClient, cfg)
+	paymentHandler := handlers.NewPaymentHandler(paymentService, webhookService, disputeService, idempotencyService)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, cfg)
+
+	// Run background jobs on one replica at a time
+	scheduler := services.NewScheduler(jobRepo, cfg)
+	scheduler.Register(services.JobWebhookRetry, cfg.WebhookRetryInterval, webhookService.RetryPendingEvents)
+	scheduler.Register(services.JobOutboxDispatch, cfg.OutboxDispatchInterval, outboxDispatcher.DispatchPending)
+	scheduler.Register(services.JobAuthorizationCheck, cfg.AuthorizationCheckInterval, authorizationMonitor.CheckExpiringAuthorizations)
+	scheduler.Register(services.JobPendingPaymentSweep, cfg.PendingSweepInterval, pendingPaymentSweeper.SweepStalePayments)
+	go scheduler.Start()
+
+	// Initialize webhook server
+	if cfg.StripeWebhookSecret == "" {
+		utils.Warn("STRIPE_WEBHOOK_SECRET is not set, all webhook deliveries will be rejected", nil)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/payment/webhook", webhookHandler)
+	if fakeProvider, ok := paymentProvider.(*providers.FakeProvider); ok {
+		mux.Handle("POST /fake/checkout/sessions/{id}/complete", handlers.NewFakeCheckoutHandler(fakeProvider, paymentService))
+	}
+
+	go func() {
+		utils.Info("Starting webhook server", map[string]interface{}{
+			"port": cfg.WebhookPort,
+		})
+
+		if err := http.ListenAndServe(":"+cfg.WebhookPort, mux); err != nil {
+			utils.Logger.Fatal("Failed to serve webhooks", map[string]interface{}{
+				"error": err,
+			})
+		}
+	}()
 
 	// Initialize grpc server
 	lis, err := net.Listen("tcp", ":"+cfg.Port)
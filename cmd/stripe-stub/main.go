@@ -0,0 +1,49 @@
+// Command stripe-stub serves an in-memory imitation of the Stripe API for local
+// development and integration tests. Point the payment service at it with
+// STRIPE_API_URL and drive payments through its /_stub control endpoints.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+
+	"github.com/PharmaKart/payment-svc/internal/stripestub"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+)
+
+func main() {
+	// Initialize logger
+	utils.InitLogger()
+
+	port := flag.String("port", envOr("STRIPE_STUB_PORT", "12111"), "port to listen on")
+	webhookURL := flag.String("webhook-url", envOr("STRIPE_STUB_WEBHOOK_URL", "http://localhost:8080/payment/webhook"), "endpoint events are delivered to, empty to only store them")
+	webhookSecret := flag.String("webhook-secret", os.Getenv("STRIPE_WEBHOOK_SECRET"), "secret used to sign delivered events")
+	publicURL := flag.String("public-url", envOr("STRIPE_STUB_PUBLIC_URL", "http://localhost:12111"), "base of the checkout page URLs handed out")
+	refundStatus := flag.String("refund-status", envOr("STRIPE_STUB_REFUND_STATUS", "succeeded"), "status new refunds start in, succeeded or pending")
+	flag.Parse()
+
+	server := stripestub.New(stripestub.Config{
+		PublicURL:     *publicURL,
+		WebhookURL:    *webhookURL,
+		WebhookSecret: *webhookSecret,
+		RefundStatus:  *refundStatus,
+	})
+
+	utils.Info("Stripe stub is running", map[string]interface{}{
+		"port":        *port,
+		"webhook_url": *webhookURL,
+	})
+	if err := http.ListenAndServe(":"+*port, server); err != nil {
+		utils.Logger.Fatal("Failed to serve Stripe stub", map[string]interface{}{
+			"error": err,
+		})
+	}
+}
+
+func envOr(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
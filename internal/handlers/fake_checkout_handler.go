@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/providers"
+	"github.com/PharmaKart/payment-svc/internal/services"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+)
+
+// fakeCheckoutActor is recorded for payments settled through the fake provider,
+// which stands in for Stripe's webhooks.
+var fakeCheckoutActor = models.Actor{
+	ID:     "fake-provider",
+	Source: models.ChangeSourceWebhook,
+}
+
+type fakeCheckoutHandler struct {
+	provider       *providers.FakeProvider
+	paymentService services.PaymentService
+}
+
+// NewFakeCheckoutHandler serves POST /fake/checkout/sessions/{id}/complete, which
+// pays for a checkout session of the fake provider with its configured outcome
+// and settles the session's payment, as Stripe's webhooks would. It is only
+// meant to be served when the service runs with the fake provider.
+func NewFakeCheckoutHandler(provider *providers.FakeProvider, paymentService services.PaymentService) *fakeCheckoutHandler {
+	return &fakeCheckoutHandler{
+		provider:       provider,
+		paymentService: paymentService,
+	}
+}
+
+type fakeCheckoutResponse struct {
+	SessionID     string `json:"session_id"`
+	SessionStatus string `json:"session_status"`
+	PaymentID     string `json:"payment_id"`
+	PaymentStatus string `json:"payment_status"`
+}
+
+func (h *fakeCheckoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	session, err := h.provider.CompleteCheckoutSession(r.PathValue("id"))
+	if err != nil {
+		status := http.StatusConflict
+		if providers.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	payment, err := h.paymentService.ReconcileCheckoutSession(session.ID, fakeCheckoutActor)
+	if err != nil {
+		utils.Error("Failed to settle fake checkout session", map[string]interface{}{
+			"session_id": session.ID,
+			"error":      err.Error(),
+		})
+
+		status := http.StatusInternalServerError
+		if appErr, ok := errors.IsAppError(err); ok && appErr.Type == errors.NotFoundError {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fakeCheckoutResponse{
+		SessionID:     session.ID,
+		SessionStatus: session.Status,
+		PaymentID:     payment.ID.String(),
+		PaymentStatus: payment.Status,
+	})
+}
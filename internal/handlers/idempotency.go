@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/PharmaKart/payment-svc/internal/proto"
+	"github.com/PharmaKart/payment-svc/internal/services"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// idempotentResponse is implemented by the responses of the mutating RPCs.
+type idempotentResponse interface {
+	protobuf.Message
+	GetSuccess() bool
+	GetError() *proto.Error
+}
+
+// idempotent runs a mutating RPC at most once per idempotency key. The key is
+// optional on every mutating RPC. A retry with the same key and request gets
+// the stored response of the first call, while reusing a key for a different
+// request is a conflict. Only successful responses are stored. A call rejected
+// with a client error releases the key so the client can retry it, but a call
+// that failed with an internal error may have moved money before it failed, so
+// its key stays in progress until the lock times out and a retry takes it over.
+// Requests without a key are run as is. The services also pass the key on to
+// the payment provider, prefixed with the operation, so a retry that reaches
+// Stripe is not acted on twice.
+func idempotent[T idempotentResponse](idempotencyService services.IdempotencyService, method string, key string, req protobuf.Message, run func() T, fail func(err error) T) T {
+	if key == "" {
+		return run()
+	}
+
+	requestHash, err := hashRequest(req)
+	if err != nil {
+		return fail(errors.NewInternalError(err))
+	}
+
+	stored, replayed, err := idempotencyService.Begin(method, key, requestHash)
+	if err != nil {
+		return fail(err)
+	}
+
+	if replayed {
+		var resp T
+		resp = resp.ProtoReflect().New().Interface().(T)
+		if err := protobuf.Unmarshal(stored, resp); err != nil {
+			return fail(errors.NewInternalError(err))
+		}
+		return resp
+	}
+
+	resp := run()
+
+	if !resp.GetSuccess() {
+		if resp.GetError().GetType() == string(errors.InternalError) {
+			utils.Warn("Keeping idempotency key of a failed request whose outcome is unknown", map[string]interface{}{
+				"method": method,
+				"key":    key,
+			})
+			return resp
+		}
+		if err := idempotencyService.Release(method, key); err != nil {
+			utils.Error("Failed to release idempotency key", map[string]interface{}{
+				"method": method,
+				"key":    key,
+				"error":  err.Error(),
+			})
+		}
+		return resp
+	}
+
+	response, err := protobuf.Marshal(resp)
+	if err == nil {
+		err = idempotencyService.Complete(method, key, response)
+	}
+	if err != nil {
+		// The request already succeeded, so its response is still returned. The
+		// key stays in progress until the lock times out.
+		utils.Error("Failed to store idempotent response", map[string]interface{}{
+			"method": method,
+			"key":    key,
+			"error":  err.Error(),
+		})
+	}
+
+	return resp
+}
+
+// hashRequest fingerprints a request so a reused key can be matched against the
+// request it was first used with.
+func hashRequest(req protobuf.Message) (string, error) {
+	body, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/proto"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/internal/services"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/google/uuid"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// memoryIdempotencyKeyRepository keeps idempotency keys in memory.
+type memoryIdempotencyKeyRepository struct {
+	mu   sync.Mutex
+	keys map[string]*models.IdempotencyKey
+}
+
+func newMemoryIdempotencyKeyRepository() *memoryIdempotencyKeyRepository {
+	return &memoryIdempotencyKeyRepository{keys: map[string]*models.IdempotencyKey{}}
+}
+
+func (r *memoryIdempotencyKeyRepository) ReserveKey(key *models.IdempotencyKey, staleBefore time.Time) (*models.IdempotencyKey, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.keys[key.Method+"/"+key.Key]
+	if !ok {
+		reserved := *key
+		reserved.Status = models.IdempotencyKeyStatusInProgress
+		reserved.UpdatedAt = time.Now()
+		r.keys[key.Method+"/"+key.Key] = &reserved
+		return &reserved, true, nil
+	}
+	if existing.RequestHash == key.RequestHash && existing.Status == models.IdempotencyKeyStatusInProgress && existing.UpdatedAt.Before(staleBefore) {
+		existing.UpdatedAt = time.Now()
+		return existing, true, nil
+	}
+	found := *existing
+	return &found, false, nil
+}
+
+func (r *memoryIdempotencyKeyRepository) CompleteKey(method string, key string, response []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.keys[method+"/"+key]
+	if !ok {
+		return errors.NewNotFoundError(fmt.Sprintf("Idempotency key '%s' not found", key))
+	}
+	existing.Status = models.IdempotencyKeyStatusCompleted
+	existing.Response = response
+	existing.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memoryIdempotencyKeyRepository) ReleaseKey(method string, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.keys[method+"/"+key]; ok && existing.Status == models.IdempotencyKeyStatusInProgress {
+		delete(r.keys, method+"/"+key)
+	}
+	return nil
+}
+
+func (r *memoryIdempotencyKeyRepository) status(method string, key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.keys[method+"/"+key]; ok {
+		return existing.Status
+	}
+	return ""
+}
+
+// expire makes a key look as if its lock timed out.
+func (r *memoryIdempotencyKeyRepository) expire(method string, key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.keys[method+"/"+key]; ok {
+		existing.UpdatedAt = time.Now().Add(-time.Hour)
+	}
+}
+
+var _ repositories.IdempotencyKeyRepository = (*memoryIdempotencyKeyRepository)(nil)
+
+// refundCounter counts the refunds the handler asks for and fails them with
+// the queued errors before refunding.
+type refundCounter struct {
+	services.PaymentService
+	failures []error
+	calls    int
+}
+
+func (s *refundCounter) RefundPayment(transactionId string, amount money.Money, reason string, actor models.Actor, idempotencyKey string) (*models.Refund, *models.RefundApproval, error) {
+	s.calls++
+	if len(s.failures) > 0 {
+		err := s.failures[0]
+		s.failures = s.failures[1:]
+		return nil, nil, err
+	}
+	return &models.Refund{ID: uuid.New(), Amount: amount, Reason: reason, Status: models.RefundStatusSucceeded}, nil, nil
+}
+
+func newIdempotencyFixture(failures ...error) (*paymentHandler, *refundCounter, *memoryIdempotencyKeyRepository) {
+	keys := newMemoryIdempotencyKeyRepository()
+	refunds := &refundCounter{failures: failures}
+	return NewPaymentHandler(refunds, nil, nil, services.NewIdempotencyService(keys)), refunds, keys
+}
+
+func refundRequest(key string, amountMinor int64) *proto.RefundPaymentRequest {
+	return &proto.RefundPaymentRequest{
+		TransactionId:  "pi_test",
+		AmountMinor:    amountMinor,
+		Currency:       "cad",
+		Reason:         models.RefundReasonRequestedByCustomer,
+		IdempotencyKey: key,
+	}
+}
+
+func TestIdempotentRequestIsReplayed(t *testing.T) {
+	handler, refunds, _ := newIdempotencyFixture()
+
+	first, _ := handler.RefundPayment(context.Background(), refundRequest("key-1", 1000))
+	retry, _ := handler.RefundPayment(context.Background(), refundRequest("key-1", 1000))
+
+	if !first.Success {
+		t.Fatalf("first call failed: %v", first.Error)
+	}
+	if refunds.calls != 1 {
+		t.Errorf("refunded %d times, want once", refunds.calls)
+	}
+	if !protobuf.Equal(first, retry) {
+		t.Errorf("retry got %v, want the first response %v", retry, first)
+	}
+}
+
+func TestIdempotencyKeyConflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, handler *paymentHandler)
+	}{
+		{"reused for a different request", func(t *testing.T, handler *paymentHandler) {
+			if resp, _ := handler.RefundPayment(context.Background(), refundRequest("key-1", 500)); !resp.Success {
+				t.Fatalf("first call failed: %v", resp.Error)
+			}
+		}},
+		{"first request still in progress", func(t *testing.T, handler *paymentHandler) {
+			hash, err := hashRequest(refundRequest("key-1", 1000))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := handler.idempotencyService.Begin("RefundPayment", "key-1", hash); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, refunds, _ := newIdempotencyFixture()
+			tt.setup(t, handler)
+			calls := refunds.calls
+
+			resp, _ := handler.RefundPayment(context.Background(), refundRequest("key-1", 1000))
+
+			if resp.Success || resp.Error.GetType() != string(errors.ConflictError) {
+				t.Errorf("got %v, want a conflict", resp)
+			}
+			if refunds.calls != calls {
+				t.Errorf("refunded again despite the conflict")
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyIsReleasedWhenRequestIsRejected(t *testing.T) {
+	handler, refunds, _ := newIdempotencyFixture(errors.NewValidationError("amount", "Exceeds the refundable amount"))
+
+	if resp, _ := handler.RefundPayment(context.Background(), refundRequest("key-1", 1000)); resp.Success {
+		t.Fatal("rejected refund succeeded")
+	}
+	retry, _ := handler.RefundPayment(context.Background(), refundRequest("key-1", 1000))
+
+	if !retry.Success || refunds.calls != 2 {
+		t.Errorf("retry got %v after %d calls, want it run again and succeed", retry, refunds.calls)
+	}
+}
+
+func TestIdempotencyKeyIsKeptWhenOutcomeIsUnknown(t *testing.T) {
+	// The provider call timed out, so the refund may have gone through.
+	handler, refunds, keys := newIdempotencyFixture(fmt.Errorf("stripe: request timed out"))
+
+	if resp, _ := handler.RefundPayment(context.Background(), refundRequest("key-1", 1000)); resp.Error.GetType() != string(errors.InternalError) {
+		t.Fatalf("got %v, want an internal error", resp)
+	}
+	if status := keys.status("RefundPayment", "key-1"); status != models.IdempotencyKeyStatusInProgress {
+		t.Fatalf("key is %q, want it kept in progress", status)
+	}
+
+	retry, _ := handler.RefundPayment(context.Background(), refundRequest("key-1", 1000))
+
+	if retry.Success || retry.Error.GetType() != string(errors.ConflictError) {
+		t.Errorf("retry got %v, want a conflict until the lock times out", retry)
+	}
+	if refunds.calls != 1 {
+		t.Errorf("refunded %d times, want once", refunds.calls)
+	}
+
+	// Once the lock times out the retry takes the key over, and the provider's
+	// idempotency key keeps it from refunding twice.
+	keys.expire("RefundPayment", "key-1")
+	if retry, _ := handler.RefundPayment(context.Background(), refundRequest("key-1", 1000)); !retry.Success || refunds.calls != 2 {
+		t.Errorf("retry after the lock timed out got %v after %d calls, want it run again", retry, refunds.calls)
+	}
+}
@@ -6,10 +6,9 @@ import (
 
 	"github.com/PharmaKart/payment-svc/internal/models"
 	"github.com/PharmaKart/payment-svc/internal/proto"
-	"github.com/PharmaKart/payment-svc/internal/repositories"
 	"github.com/PharmaKart/payment-svc/internal/services"
-	"github.com/PharmaKart/payment-svc/pkg/config"
 	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/money"
 	"github.com/PharmaKart/payment-svc/pkg/utils"
 	"github.com/google/uuid"
 )
@@ -18,24 +17,52 @@ type PaymentHandler interface {
 	GeneratePaymentURL(ctx context.Context, req *proto.GeneratePaymentURLRequest) (*proto.GeneratePaymentURLResponse, error)
 	StorePayment(ctx context.Context, req *proto.StorePaymentRequest) (*proto.StorePaymentResponse, error)
 	RefundPayment(ctx context.Context, req *proto.RefundPaymentRequest) (*proto.RefundPaymentResponse, error)
+	ApproveRefund(ctx context.Context, req *proto.ApproveRefundRequest) (*proto.ApproveRefundResponse, error)
+	RejectRefund(ctx context.Context, req *proto.RejectRefundRequest) (*proto.RejectRefundResponse, error)
+	CapturePayment(ctx context.Context, req *proto.CapturePaymentRequest) (*proto.CapturePaymentResponse, error)
+	VoidPayment(ctx context.Context, req *proto.VoidPaymentRequest) (*proto.VoidPaymentResponse, error)
+	ResolveManualReview(ctx context.Context, req *proto.ResolveManualReviewRequest) (*proto.ResolveManualReviewResponse, error)
 	GetPaymentByTransactionID(ctx context.Context, req *proto.GetPaymentByTransactionIDRequest) (*proto.GetPaymentResponse, error)
 	GetPayment(ctx context.Context, req *proto.GetPaymentRequest) (*proto.GetPaymentResponse, error)
 	GetPaymentByOrderID(ctx context.Context, req *proto.GetPaymentByOrderIDRequest) (*proto.GetPaymentResponse, error)
+	ListPaymentAttempts(ctx context.Context, req *proto.ListPaymentAttemptsRequest) (*proto.ListPaymentAttemptsResponse, error)
+	GetPaymentTimeline(ctx context.Context, req *proto.GetPaymentTimelineRequest) (*proto.GetPaymentTimelineResponse, error)
+	ListFailedWebhookEvents(ctx context.Context, req *proto.ListFailedWebhookEventsRequest) (*proto.ListFailedWebhookEventsResponse, error)
+	ReplayWebhookEvent(ctx context.Context, req *proto.ReplayWebhookEventRequest) (*proto.ReplayWebhookEventResponse, error)
+	ListOpenDisputes(ctx context.Context, req *proto.ListOpenDisputesRequest) (*proto.ListOpenDisputesResponse, error)
+	UpdateDisputeEvidence(ctx context.Context, req *proto.UpdateDisputeEvidenceRequest) (*proto.UpdateDisputeEvidenceResponse, error)
 }
 
 type paymentHandler struct {
 	proto.UnimplementedPaymentServiceServer
-	paymentService services.PaymentService
+	paymentService     services.PaymentService
+	webhookService     services.WebhookService
+	disputeService     services.DisputeService
+	idempotencyService services.IdempotencyService
 }
 
-func NewPaymentHandler(paymentRepo repositories.PaymentRepository, orderClient *proto.OrderServiceClient, cfg *config.Config) *paymentHandler {
+func NewPaymentHandler(paymentService services.PaymentService, webhookService services.WebhookService, disputeService services.DisputeService, idempotencyService services.IdempotencyService) *paymentHandler {
 	return &paymentHandler{
-		paymentService: services.NewPaymentService(paymentRepo, orderClient, cfg),
+		paymentService:     paymentService,
+		webhookService:     webhookService,
+		disputeService:     disputeService,
+		idempotencyService: idempotencyService,
 	}
 }
 
 func (h *paymentHandler) GeneratePaymentURL(ctx context.Context, req *proto.GeneratePaymentURLRequest) (*proto.GeneratePaymentURLResponse, error) {
-	resp, err := h.paymentService.GeneratePaymentURL(req.OrderId, req.CustomerId)
+	return idempotent(h.idempotencyService, "GeneratePaymentURL", req.IdempotencyKey, req, func() *proto.GeneratePaymentURLResponse {
+		return h.generatePaymentURL(req)
+	}, func(err error) *proto.GeneratePaymentURLResponse {
+		return &proto.GeneratePaymentURLResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}), nil
+}
+
+func (h *paymentHandler) generatePaymentURL(req *proto.GeneratePaymentURLRequest) *proto.GeneratePaymentURLResponse {
+	resp, err := h.paymentService.GeneratePaymentURL(req.OrderId, req.CustomerId, req.IdempotencyKey)
 	if err != nil {
 		if appErr, ok := errors.IsAppError(err); ok {
 			return &proto.GeneratePaymentURLResponse{
@@ -45,7 +72,7 @@ func (h *paymentHandler) GeneratePaymentURL(ctx context.Context, req *proto.Gene
 					Message: appErr.Message,
 					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
 				},
-			}, nil
+			}
 		}
 		return &proto.GeneratePaymentURLResponse{
 			Success: false,
@@ -53,16 +80,30 @@ func (h *paymentHandler) GeneratePaymentURL(ctx context.Context, req *proto.Gene
 				Type:    string(errors.InternalError),
 				Message: err.Error(),
 			},
-		}, nil
+		}
 	}
 
 	return &proto.GeneratePaymentURLResponse{
-		Success: true,
-		Url:     resp.URL,
-	}, nil
+		Success:   true,
+		PaymentId: resp.PaymentID,
+		Url:       resp.URL,
+		SessionId: resp.SessionID,
+		ExpiresAt: resp.ExpiresAt.Unix(),
+	}
 }
 
 func (h *paymentHandler) StorePayment(ctx context.Context, req *proto.StorePaymentRequest) (*proto.StorePaymentResponse, error) {
+	return idempotent(h.idempotencyService, "StorePayment", req.IdempotencyKey, req, func() *proto.StorePaymentResponse {
+		return h.storePayment(req)
+	}, func(err error) *proto.StorePaymentResponse {
+		return &proto.StorePaymentResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}), nil
+}
+
+func (h *paymentHandler) storePayment(req *proto.StorePaymentRequest) *proto.StorePaymentResponse {
 	orderId, err := uuid.Parse(req.OrderId)
 	if err != nil {
 		return &proto.StorePaymentResponse{
@@ -72,7 +113,7 @@ func (h *paymentHandler) StorePayment(ctx context.Context, req *proto.StorePayme
 				Message: "Invalid order ID",
 				Details: utils.ConvertMapToKeyValuePairs(map[string]string{"order_id": fmt.Sprintf("Invalid UUID: %s", req.OrderId)}),
 			},
-		}, nil
+		}
 	}
 
 	customerId, err := uuid.Parse(req.CustomerId)
@@ -84,17 +125,18 @@ func (h *paymentHandler) StorePayment(ctx context.Context, req *proto.StorePayme
 				Message: "Invalid customer ID",
 				Details: utils.ConvertMapToKeyValuePairs(map[string]string{"customer_id": fmt.Sprintf("Invalid UUID: %s", req.CustomerId)}),
 			},
-		}, nil
+		}
 	}
 
 	payment := &models.Payment{
 		OrderID:       orderId,
 		CustomerID:    customerId,
 		TransactionID: req.TransactionId,
-		Amount:        req.Amount,
+		Amount:        amountFromRequest(req.AmountMinor, req.Amount, req.Currency),
 		Status:        req.Status,
+		FailureReason: req.FailureReason,
 	}
-	message, err := h.paymentService.StorePayment(payment)
+	message, err := h.paymentService.StorePayment(payment, rpcActor(req.Actor))
 	if err != nil {
 		if appErr, ok := errors.IsAppError(err); ok {
 			return &proto.StorePaymentResponse{
@@ -104,7 +146,7 @@ func (h *paymentHandler) StorePayment(ctx context.Context, req *proto.StorePayme
 					Message: appErr.Message,
 					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
 				},
-			}, nil
+			}
 		}
 		return &proto.StorePaymentResponse{
 			Success: false,
@@ -112,17 +154,28 @@ func (h *paymentHandler) StorePayment(ctx context.Context, req *proto.StorePayme
 				Type:    string(errors.InternalError),
 				Message: "An unexpected error occurred",
 			},
-		}, nil
+		}
 	}
 
 	return &proto.StorePaymentResponse{
 		Success: true,
 		Message: message,
-	}, nil
+	}
 }
 
 func (h *paymentHandler) RefundPayment(ctx context.Context, req *proto.RefundPaymentRequest) (*proto.RefundPaymentResponse, error) {
-	err := h.paymentService.RefundPayment(req.TransactionId)
+	return idempotent(h.idempotencyService, "RefundPayment", req.IdempotencyKey, req, func() *proto.RefundPaymentResponse {
+		return h.refundPayment(req)
+	}, func(err error) *proto.RefundPaymentResponse {
+		return &proto.RefundPaymentResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}), nil
+}
+
+func (h *paymentHandler) refundPayment(req *proto.RefundPaymentRequest) *proto.RefundPaymentResponse {
+	refund, approval, err := h.paymentService.RefundPayment(req.TransactionId, amountFromRequest(req.AmountMinor, req.Amount, req.Currency), req.Reason, rpcActor(req.Actor), req.IdempotencyKey)
 	if err != nil {
 		if appErr, ok := errors.IsAppError(err); ok {
 			return &proto.RefundPaymentResponse{
@@ -132,7 +185,7 @@ func (h *paymentHandler) RefundPayment(ctx context.Context, req *proto.RefundPay
 					Message: appErr.Message,
 					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
 				},
-			}, nil
+			}
 		}
 		return &proto.RefundPaymentResponse{
 			Success: false,
@@ -140,12 +193,187 @@ func (h *paymentHandler) RefundPayment(ctx context.Context, req *proto.RefundPay
 				Type:    string(errors.InternalError),
 				Message: "An unexpected error occurred",
 			},
-		}, nil
+		}
+	}
+
+	if approval != nil {
+		return &proto.RefundPaymentResponse{
+			Success:          true,
+			Message:          "Refund is awaiting approval",
+			Status:           "awaiting_approval",
+			Amount:           approval.Amount.Major(),
+			AmountMinor:      approval.Amount.Minor,
+			Currency:         approval.Amount.Currency,
+			RefundApprovalId: approval.ID.String(),
+		}
+	}
+
+	message := "Payment refunded successfully"
+	if refund.Status != models.RefundStatusSucceeded {
+		message = "Refund is being processed"
 	}
 
 	return &proto.RefundPaymentResponse{
-		Success: true,
-	}, nil
+		Success:     true,
+		Message:     message,
+		RefundId:    refund.ID.String(),
+		Status:      refund.Status,
+		Amount:      refund.Amount.Major(),
+		AmountMinor: refund.Amount.Minor,
+		Currency:    refund.Amount.Currency,
+	}
+}
+
+func (h *paymentHandler) ApproveRefund(ctx context.Context, req *proto.ApproveRefundRequest) (*proto.ApproveRefundResponse, error) {
+	return idempotent(h.idempotencyService, "ApproveRefund", req.IdempotencyKey, req, func() *proto.ApproveRefundResponse {
+		return h.approveRefund(req)
+	}, func(err error) *proto.ApproveRefundResponse {
+		return &proto.ApproveRefundResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}), nil
+}
+
+func (h *paymentHandler) approveRefund(req *proto.ApproveRefundRequest) *proto.ApproveRefundResponse {
+	approval, refund, err := h.paymentService.ApproveRefund(req.RefundApprovalId, rpcActor(req.Actor), req.Comment)
+	if err != nil {
+		return &proto.ApproveRefundResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}
+
+	message := "Refund approved and issued successfully"
+	if refund.Status != models.RefundStatusSucceeded {
+		message = "Refund approved and being processed"
+	}
+
+	return &proto.ApproveRefundResponse{
+		Success:        true,
+		Message:        message,
+		RefundApproval: refundApprovalToProto(approval),
+		RefundId:       refund.ID.String(),
+		RefundStatus:   refund.Status,
+	}
+}
+
+func (h *paymentHandler) RejectRefund(ctx context.Context, req *proto.RejectRefundRequest) (*proto.RejectRefundResponse, error) {
+	return idempotent(h.idempotencyService, "RejectRefund", req.IdempotencyKey, req, func() *proto.RejectRefundResponse {
+		return h.rejectRefund(req)
+	}, func(err error) *proto.RejectRefundResponse {
+		return &proto.RejectRefundResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}), nil
+}
+
+func (h *paymentHandler) rejectRefund(req *proto.RejectRefundRequest) *proto.RejectRefundResponse {
+	approval, err := h.paymentService.RejectRefund(req.RefundApprovalId, rpcActor(req.Actor), req.Comment)
+	if err != nil {
+		return &proto.RejectRefundResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}
+
+	return &proto.RejectRefundResponse{
+		Success:        true,
+		Message:        "Refund rejected successfully",
+		RefundApproval: refundApprovalToProto(approval),
+	}
+}
+
+func (h *paymentHandler) CapturePayment(ctx context.Context, req *proto.CapturePaymentRequest) (*proto.CapturePaymentResponse, error) {
+	return idempotent(h.idempotencyService, "CapturePayment", req.IdempotencyKey, req, func() *proto.CapturePaymentResponse {
+		return h.capturePayment(req)
+	}, func(err error) *proto.CapturePaymentResponse {
+		return &proto.CapturePaymentResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}), nil
+}
+
+func (h *paymentHandler) capturePayment(req *proto.CapturePaymentRequest) *proto.CapturePaymentResponse {
+	payment, err := h.paymentService.CapturePayment(req.OrderId, rpcActor(req.Actor), req.IdempotencyKey)
+	if err != nil {
+		return &proto.CapturePaymentResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}
+
+	message := "Payment captured successfully"
+	if payment.Status == models.PaymentStatusManualReview {
+		message = "Payment captured and held for manual review"
+	}
+
+	return &proto.CapturePaymentResponse{
+		Success:     true,
+		Message:     message,
+		PaymentId:   payment.ID.String(),
+		Status:      payment.Status,
+		AmountMinor: payment.Amount.Minor,
+		Currency:    payment.Amount.Currency,
+	}
+}
+
+func (h *paymentHandler) VoidPayment(ctx context.Context, req *proto.VoidPaymentRequest) (*proto.VoidPaymentResponse, error) {
+	return idempotent(h.idempotencyService, "VoidPayment", req.IdempotencyKey, req, func() *proto.VoidPaymentResponse {
+		return h.voidPayment(req)
+	}, func(err error) *proto.VoidPaymentResponse {
+		return &proto.VoidPaymentResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}), nil
+}
+
+func (h *paymentHandler) voidPayment(req *proto.VoidPaymentRequest) *proto.VoidPaymentResponse {
+	payment, err := h.paymentService.VoidPayment(req.OrderId, req.Reason, rpcActor(req.Actor), req.IdempotencyKey)
+	if err != nil {
+		return &proto.VoidPaymentResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}
+
+	return &proto.VoidPaymentResponse{
+		Success:   true,
+		Message:   "Payment voided successfully",
+		PaymentId: payment.ID.String(),
+		Status:    payment.Status,
+	}
+}
+
+func (h *paymentHandler) ResolveManualReview(ctx context.Context, req *proto.ResolveManualReviewRequest) (*proto.ResolveManualReviewResponse, error) {
+	return idempotent(h.idempotencyService, "ResolveManualReview", req.IdempotencyKey, req, func() *proto.ResolveManualReviewResponse {
+		return h.resolveManualReview(req)
+	}, func(err error) *proto.ResolveManualReviewResponse {
+		return &proto.ResolveManualReviewResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}), nil
+}
+
+func (h *paymentHandler) resolveManualReview(req *proto.ResolveManualReviewRequest) *proto.ResolveManualReviewResponse {
+	payment, err := h.paymentService.ResolveManualReview(req.PaymentId, req.Note, rpcActor(req.Actor))
+	if err != nil {
+		return &proto.ResolveManualReviewResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}
+
+	return &proto.ResolveManualReviewResponse{
+		Success:   true,
+		Message:   "Payment released from manual review",
+		PaymentId: payment.ID.String(),
+		Status:    payment.Status,
+	}
 }
 
 func (h *paymentHandler) GetPaymentByTransactionID(ctx context.Context, req *proto.GetPaymentByTransactionIDRequest) (*proto.GetPaymentResponse, error) {
@@ -184,13 +412,17 @@ func (h *paymentHandler) GetPaymentByTransactionID(ctx context.Context, req *pro
 	}
 
 	return &proto.GetPaymentResponse{
-		Success:       true,
-		PaymentId:     payment.ID.String(),
-		OrderId:       payment.OrderID.String(),
-		CustomerId:    payment.CustomerID.String(),
-		TransactionId: payment.TransactionID,
-		Amount:        payment.Amount,
-		Status:        payment.Status,
+		Success:                true,
+		PaymentId:              payment.ID.String(),
+		OrderId:                payment.OrderID.String(),
+		CustomerId:             payment.CustomerID.String(),
+		TransactionId:          payment.TransactionID,
+		Amount:                 payment.Amount.Major(),
+		AmountMinor:            payment.Amount.Minor,
+		Currency:               payment.Amount.Currency,
+		Status:                 payment.Status,
+		CaptureMethod:          payment.CaptureMethod,
+		AuthorizationExpiresAt: authorizationExpiresAt(payment),
 	}, nil
 }
 
@@ -230,13 +462,17 @@ func (h *paymentHandler) GetPayment(ctx context.Context, req *proto.GetPaymentRe
 	}
 
 	return &proto.GetPaymentResponse{
-		Success:       true,
-		PaymentId:     payment.ID.String(),
-		OrderId:       payment.OrderID.String(),
-		CustomerId:    payment.CustomerID.String(),
-		TransactionId: payment.TransactionID,
-		Amount:        payment.Amount,
-		Status:        payment.Status,
+		Success:                true,
+		PaymentId:              payment.ID.String(),
+		OrderId:                payment.OrderID.String(),
+		CustomerId:             payment.CustomerID.String(),
+		TransactionId:          payment.TransactionID,
+		Amount:                 payment.Amount.Major(),
+		AmountMinor:            payment.Amount.Minor,
+		Currency:               payment.Amount.Currency,
+		Status:                 payment.Status,
+		CaptureMethod:          payment.CaptureMethod,
+		AuthorizationExpiresAt: authorizationExpiresAt(payment),
 	}, nil
 }
 
@@ -276,12 +512,379 @@ func (h *paymentHandler) GetPaymentByOrderID(ctx context.Context, req *proto.Get
 	}
 
 	return &proto.GetPaymentResponse{
-		Success:       true,
-		PaymentId:     payment.ID.String(),
-		OrderId:       payment.OrderID.String(),
-		CustomerId:    payment.CustomerID.String(),
-		TransactionId: payment.TransactionID,
-		Amount:        payment.Amount,
-		Status:        payment.Status,
+		Success:                true,
+		PaymentId:              payment.ID.String(),
+		OrderId:                payment.OrderID.String(),
+		CustomerId:             payment.CustomerID.String(),
+		TransactionId:          payment.TransactionID,
+		Amount:                 payment.Amount.Major(),
+		AmountMinor:            payment.Amount.Minor,
+		Currency:               payment.Amount.Currency,
+		Status:                 payment.Status,
+		CaptureMethod:          payment.CaptureMethod,
+		AuthorizationExpiresAt: authorizationExpiresAt(payment),
+	}, nil
+}
+
+func (h *paymentHandler) ListPaymentAttempts(ctx context.Context, req *proto.ListPaymentAttemptsRequest) (*proto.ListPaymentAttemptsResponse, error) {
+	payments, err := h.paymentService.ListPaymentAttempts(req.OrderId)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.ListPaymentAttemptsResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.ListPaymentAttemptsResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	customerId := req.CustomerId
+
+	attempts := make([]*proto.Payment, 0, len(payments))
+	for _, payment := range payments {
+		if customerId != "admin" && payment.CustomerID.String() != customerId {
+			return &proto.ListPaymentAttemptsResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(errors.AuthError),
+					Message: "You are not authorized to view these payments",
+				},
+			}, nil
+		}
+
+		attempts = append(attempts, &proto.Payment{
+			PaymentId:              payment.ID.String(),
+			TransactionId:          payment.TransactionID,
+			OrderId:                payment.OrderID.String(),
+			CustomerId:             payment.CustomerID.String(),
+			AmountMinor:            payment.Amount.Minor,
+			Currency:               payment.Amount.Currency,
+			Status:                 payment.Status,
+			FailureReason:          payment.FailureReason,
+			CreatedAt:              payment.CreatedAt.Unix(),
+			CaptureMethod:          payment.CaptureMethod,
+			AuthorizationExpiresAt: authorizationExpiresAt(&payment),
+		})
+	}
+
+	return &proto.ListPaymentAttemptsResponse{
+		Success:  true,
+		Attempts: attempts,
+	}, nil
+}
+
+func (h *paymentHandler) GetPaymentTimeline(ctx context.Context, req *proto.GetPaymentTimelineRequest) (*proto.GetPaymentTimelineResponse, error) {
+	customerId := req.CustomerId
+
+	if customerId != "admin" {
+		payments, err := h.paymentService.ListPaymentAttempts(req.OrderId)
+		if appErr, ok := errors.IsAppError(err); err != nil && (!ok || appErr.Type != errors.NotFoundError) {
+			return &proto.GetPaymentTimelineResponse{
+				Success: false,
+				Error:   protoError(err),
+			}, nil
+		}
+		for _, payment := range payments {
+			if payment.CustomerID.String() != customerId {
+				return &proto.GetPaymentTimelineResponse{
+					Success: false,
+					Error: &proto.Error{
+						Type:    string(errors.AuthError),
+						Message: "You are not authorized to view this payment history",
+					},
+				}, nil
+			}
+		}
+	}
+
+	changes, err := h.paymentService.GetPaymentTimeline(req.OrderId)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.GetPaymentTimelineResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.GetPaymentTimelineResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	entries := make([]*proto.PaymentTimelineEntry, 0, len(changes))
+	for _, change := range changes {
+		entries = append(entries, &proto.PaymentTimelineEntry{
+			PaymentId:  change.PaymentID.String(),
+			Action:     change.Action,
+			FromStatus: change.FromStatus,
+			ToStatus:   change.ToStatus,
+			Actor:      change.ActorID,
+			Source:     change.Source,
+			Note:       change.Note,
+			CreatedAt:  change.CreatedAt.Unix(),
+		})
+	}
+
+	return &proto.GetPaymentTimelineResponse{
+		Success: true,
+		Entries: entries,
+	}, nil
+}
+
+func (h *paymentHandler) ListFailedWebhookEvents(ctx context.Context, req *proto.ListFailedWebhookEventsRequest) (*proto.ListFailedWebhookEventsResponse, error) {
+	page := req.Page
+	if page < 1 {
+		page = 1
+	}
+
+	limit := req.Limit
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	events, total, err := h.webhookService.ListFailedEvents(page, limit)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.ListFailedWebhookEventsResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.ListFailedWebhookEventsResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: "An unexpected error occurred",
+			},
+		}, nil
+	}
+
+	protoEvents := make([]*proto.WebhookEvent, 0, len(events))
+	for _, event := range events {
+		protoEvents = append(protoEvents, &proto.WebhookEvent{
+			EventId:   event.ID,
+			Type:      event.Type,
+			Status:    event.Status,
+			Attempts:  int32(event.Attempts),
+			LastError: event.LastError,
+			CreatedAt: event.CreatedAt.Unix(),
+			UpdatedAt: event.UpdatedAt.Unix(),
+		})
+	}
+
+	return &proto.ListFailedWebhookEventsResponse{
+		Success: true,
+		Events:  protoEvents,
+		Total:   int32(total),
+		Page:    page,
+		Limit:   limit,
 	}, nil
 }
+
+func (h *paymentHandler) ReplayWebhookEvent(ctx context.Context, req *proto.ReplayWebhookEventRequest) (*proto.ReplayWebhookEventResponse, error) {
+	err := h.webhookService.ReplayEvent(req.EventId)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok {
+			return &proto.ReplayWebhookEventResponse{
+				Success: false,
+				Error: &proto.Error{
+					Type:    string(appErr.Type),
+					Message: appErr.Message,
+					Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+				},
+			}, nil
+		}
+
+		return &proto.ReplayWebhookEventResponse{
+			Success: false,
+			Error: &proto.Error{
+				Type:    string(errors.InternalError),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	return &proto.ReplayWebhookEventResponse{
+		Success: true,
+		Message: "Webhook event replayed successfully",
+	}, nil
+}
+
+func (h *paymentHandler) ListOpenDisputes(ctx context.Context, req *proto.ListOpenDisputesRequest) (*proto.ListOpenDisputesResponse, error) {
+	page := req.Page
+	if page < 1 {
+		page = 1
+	}
+
+	limit := req.Limit
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	disputes, total, err := h.disputeService.ListOpenDisputes(page, limit)
+	if err != nil {
+		return &proto.ListOpenDisputesResponse{
+			Success: false,
+			Error:   protoError(err),
+		}, nil
+	}
+
+	protoDisputes := make([]*proto.Dispute, 0, len(disputes))
+	for i := range disputes {
+		protoDisputes = append(protoDisputes, disputeToProto(&disputes[i]))
+	}
+
+	return &proto.ListOpenDisputesResponse{
+		Success:  true,
+		Disputes: protoDisputes,
+		Total:    int32(total),
+		Page:     page,
+		Limit:    limit,
+	}, nil
+}
+
+func (h *paymentHandler) UpdateDisputeEvidence(ctx context.Context, req *proto.UpdateDisputeEvidenceRequest) (*proto.UpdateDisputeEvidenceResponse, error) {
+	return idempotent(h.idempotencyService, "UpdateDisputeEvidence", req.IdempotencyKey, req, func() *proto.UpdateDisputeEvidenceResponse {
+		return h.updateDisputeEvidence(req)
+	}, func(err error) *proto.UpdateDisputeEvidenceResponse {
+		return &proto.UpdateDisputeEvidenceResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}), nil
+}
+
+func (h *paymentHandler) updateDisputeEvidence(req *proto.UpdateDisputeEvidenceRequest) *proto.UpdateDisputeEvidenceResponse {
+	dispute, err := h.disputeService.UpdateDisputeEvidence(req.DisputeId, req.Evidence, req.Submit, rpcActor(req.Actor), req.IdempotencyKey)
+	if err != nil {
+		return &proto.UpdateDisputeEvidenceResponse{
+			Success: false,
+			Error:   protoError(err),
+		}
+	}
+
+	message := "Dispute evidence staged successfully"
+	if req.Submit {
+		message = "Dispute evidence submitted successfully"
+	}
+
+	return &proto.UpdateDisputeEvidenceResponse{
+		Success: true,
+		Message: message,
+		Dispute: disputeToProto(dispute),
+	}
+}
+
+// amountFromRequest prefers the minor-unit amount and falls back to the deprecated
+// major-unit field, rounding it explicitly. An empty currency is left for the
+// service to fill in.
+func amountFromRequest(amountMinor int64, amount float64, currency string) money.Money {
+	if amountMinor != 0 || amount == 0 {
+		return money.New(amountMinor, currency)
+	}
+	return money.FromMajor(amount, currency)
+}
+
+// authorizationExpiresAt returns when the payment's authorization expires as a
+// Unix timestamp, or zero if it has none.
+func authorizationExpiresAt(payment *models.Payment) int64 {
+	if payment.AuthorizationExpiresAt == nil {
+		return 0
+	}
+	return payment.AuthorizationExpiresAt.Unix()
+}
+
+func disputeToProto(dispute *models.Dispute) *proto.Dispute {
+	converted := &proto.Dispute{
+		DisputeId:       dispute.ID.String(),
+		StripeDisputeId: dispute.StripeDisputeID,
+		PaymentId:       dispute.PaymentID.String(),
+		OrderId:         dispute.OrderID.String(),
+		AmountMinor:     dispute.Amount.Minor,
+		Currency:        dispute.Amount.Currency,
+		Reason:          dispute.Reason,
+		Status:          dispute.Status,
+		Evidence:        dispute.Evidence,
+		CreatedAt:       dispute.CreatedAt.Unix(),
+		UpdatedAt:       dispute.UpdatedAt.Unix(),
+	}
+	if dispute.EvidenceDueBy != nil {
+		converted.EvidenceDueBy = dispute.EvidenceDueBy.Unix()
+	}
+	if dispute.EvidenceSubmittedAt != nil {
+		converted.EvidenceSubmittedAt = dispute.EvidenceSubmittedAt.Unix()
+	}
+	return converted
+}
+
+func refundApprovalToProto(approval *models.RefundApproval) *proto.RefundApproval {
+	converted := &proto.RefundApproval{
+		RefundApprovalId: approval.ID.String(),
+		PaymentId:        approval.PaymentID.String(),
+		AmountMinor:      approval.Amount.Minor,
+		Currency:         approval.Amount.Currency,
+		Reason:           approval.Reason,
+		Status:           approval.Status,
+		RequestedBy:      approval.RequestedBy,
+		DecidedBy:        approval.DecidedBy,
+		Comment:          approval.Comment,
+		CreatedAt:        approval.CreatedAt.Unix(),
+	}
+	if approval.DecidedAt != nil {
+		converted.DecidedAt = approval.DecidedAt.Unix()
+	}
+	if approval.RefundID != nil {
+		converted.RefundId = approval.RefundID.String()
+	}
+	return converted
+}
+
+// rpcActor attributes changes made through an RPC to the caller it names.
+func rpcActor(actorId string) models.Actor {
+	if actorId == "" {
+		actorId = models.UnknownActorID
+	}
+	return models.Actor{
+		ID:     actorId,
+		Source: models.ChangeSourceRPC,
+	}
+}
+
+// protoError converts a service error into its wire form.
+func protoError(err error) *proto.Error {
+	if appErr, ok := errors.IsAppError(err); ok {
+		return &proto.Error{
+			Type:    string(appErr.Type),
+			Message: appErr.Message,
+			Details: utils.ConvertMapToKeyValuePairs(appErr.Details),
+		}
+	}
+	return &proto.Error{
+		Type:    string(errors.InternalError),
+		Message: "An unexpected error occurred",
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/PharmaKart/payment-svc/internal/services"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+// maxWebhookBodyBytes caps the size of a webhook payload we are willing to read.
+const maxWebhookBodyBytes = int64(65536)
+
+type WebhookHandler interface {
+	ServeHTTP(w http.ResponseWriter, r *http.Request)
+}
+
+type webhookHandler struct {
+	webhookService services.WebhookService
+	webhookSecret  string
+}
+
+func NewWebhookHandler(webhookService services.WebhookService, cfg *config.Config) *webhookHandler {
+	return &webhookHandler{
+		webhookService: webhookService,
+		webhookSecret:  cfg.StripeWebhookSecret,
+	}
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		http.Error(w, "unable to read request body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Stripe CLI and dashboard endpoints may be pinned to a different API version
+	// than the SDK; the fields we read are stable across versions.
+	event, err := webhook.ConstructEventWithOptions(payload, r.Header.Get("Stripe-Signature"), h.webhookSecret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+	if err != nil {
+		utils.Warn("Rejected webhook with invalid signature", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.webhookService.IngestEvent(event, payload); err != nil {
+		utils.Error("Failed to store webhook event", map[string]interface{}{
+			"event_id":   event.ID,
+			"event_type": event.Type,
+			"error":      err.Error(),
+		})
+		// A non-2xx response makes Stripe redeliver the event later.
+		http.Error(w, "failed to store event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
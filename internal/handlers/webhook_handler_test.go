@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/services"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func TestMain(m *testing.M) {
+	utils.InitLogger()
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// ingestRecorder keeps the events the handler hands to the webhook service.
+type ingestRecorder struct {
+	services.WebhookService
+	ingested []stripe.Event
+}
+
+func (r *ingestRecorder) IngestEvent(event stripe.Event, payload []byte) error {
+	r.ingested = append(r.ingested, event)
+	return nil
+}
+
+func TestWebhookHandlerVerifiesSignatures(t *testing.T) {
+	payload := []byte(`{"id":"evt_test","object":"event","type":"checkout.session.completed","data":{"object":{}}}`)
+	signed := func(secret string, timestamp time.Time) string {
+		return webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: secret, Timestamp: timestamp}).Header
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		signature string
+		status    int
+	}{
+		{"valid signature", http.MethodPost, signed(testWebhookSecret, time.Now()), http.StatusOK},
+		{"wrong secret", http.MethodPost, signed("whsec_other", time.Now()), http.StatusBadRequest},
+		{"old timestamp", http.MethodPost, signed(testWebhookSecret, time.Now().Add(-time.Hour)), http.StatusBadRequest},
+		{"bad signature", http.MethodPost, "t=1,v1=deadbeef", http.StatusBadRequest},
+		{"no signature", http.MethodPost, "", http.StatusBadRequest},
+		{"not a POST", http.MethodGet, signed(testWebhookSecret, time.Now()), http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &ingestRecorder{}
+			handler := NewWebhookHandler(recorder, &config.Config{StripeWebhookSecret: testWebhookSecret})
+
+			req := httptest.NewRequest(tt.method, "/payment/webhook", bytes.NewReader(payload))
+			if tt.signature != "" {
+				req.Header.Set("Stripe-Signature", tt.signature)
+			}
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+
+			if resp.Code != tt.status {
+				t.Errorf("status = %d, want %d", resp.Code, tt.status)
+			}
+			if ingested := len(recorder.ingested) == 1; ingested != (tt.status == http.StatusOK) {
+				t.Errorf("ingested %d events, want the event ingested only when it is accepted", len(recorder.ingested))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Checkout session statuses mirror the statuses reported by Stripe.
+const (
+	CheckoutSessionStatusOpen     = "open"
+	CheckoutSessionStatusComplete = "complete"
+	CheckoutSessionStatusExpired  = "expired"
+)
+
+// CheckoutSession is a Stripe Checkout Session created for an order. An order has
+// at most one open session, which is handed out again until it expires or the
+// order total changes.
+type CheckoutSession struct {
+	ID              uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	StripeSessionID string      `gorm:"type:varchar(255);not null;unique"`
+	OrderID         uuid.UUID   `gorm:"type:uuid;not null;index;uniqueIndex:idx_checkout_sessions_one_open_per_order,where:status = 'open'"`
+	URL             string      `gorm:"type:text;not null"`
+	Amount          money.Money `gorm:"embedded;embeddedPrefix:amount_"`
+	CaptureMethod   string      `gorm:"type:varchar(20);not null;default:'automatic';check:capture_method IN ('automatic', 'manual')"`
+	Status          string      `gorm:"type:varchar(50);not null;default:'open';check:status IN ('open', 'complete', 'expired')"`
+	ExpiresAt       time.Time   `gorm:"type:timestamptz;not null"`
+	CreatedAt       time.Time   `gorm:"type:timestamptz;default:now()"`
+	UpdatedAt       time.Time   `gorm:"type:timestamptz;default:now()"`
+}
+
+func (c *CheckoutSession) BeforeCreate(tx *gorm.DB) (err error) {
+	c.ID = uuid.New()
+	if c.CaptureMethod == "" {
+		c.CaptureMethod = CaptureMethodAutomatic
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Dispute statuses mirror the statuses reported by Stripe for a dispute. The
+// warning statuses belong to inquiries, which the bank may still escalate.
+const (
+	DisputeStatusWarningNeedsResponse = "warning_needs_response"
+	DisputeStatusWarningUnderReview   = "warning_under_review"
+	DisputeStatusWarningClosed        = "warning_closed"
+	DisputeStatusNeedsResponse        = "needs_response"
+	DisputeStatusUnderReview          = "under_review"
+	DisputeStatusWon                  = "won"
+	DisputeStatusLost                 = "lost"
+)
+
+// OpenDisputeStatuses are the statuses of a dispute that has not been decided.
+var OpenDisputeStatuses = []string{
+	DisputeStatusWarningNeedsResponse,
+	DisputeStatusWarningUnderReview,
+	DisputeStatusNeedsResponse,
+	DisputeStatusUnderReview,
+}
+
+// DisputeEvidenceFields lists the Stripe evidence fields UpdateDisputeEvidence
+// accepts. Fields documenting something, such as receipt, take the ID of a file
+// uploaded to Stripe; the others take text.
+var DisputeEvidenceFields = []string{
+	"access_activity_log",
+	"billing_address",
+	"cancellation_policy",
+	"cancellation_policy_disclosure",
+	"cancellation_rebuttal",
+	"customer_communication",
+	"customer_email_address",
+	"customer_name",
+	"customer_purchase_ip",
+	"customer_signature",
+	"duplicate_charge_documentation",
+	"duplicate_charge_explanation",
+	"duplicate_charge_id",
+	"product_description",
+	"receipt",
+	"refund_policy",
+	"refund_policy_disclosure",
+	"refund_refusal_explanation",
+	"service_date",
+	"service_documentation",
+	"shipping_address",
+	"shipping_carrier",
+	"shipping_date",
+	"shipping_documentation",
+	"shipping_tracking_number",
+	"uncategorized_file",
+	"uncategorized_text",
+}
+
+// Dispute is a chargeback or inquiry raised by the customer's bank against a
+// payment, keyed by the Stripe dispute ID.
+type Dispute struct {
+	ID              uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PaymentID       uuid.UUID   `gorm:"type:uuid;not null;index"`
+	OrderID         uuid.UUID   `gorm:"type:uuid;not null;index"`
+	StripeDisputeID string      `gorm:"type:varchar(255);not null;uniqueIndex"`
+	Amount          money.Money `gorm:"embedded;embeddedPrefix:amount_"`
+	Reason          string      `gorm:"type:varchar(50);not null"`
+	Status          string      `gorm:"type:varchar(50);not null;index;check:status IN ('warning_needs_response', 'warning_under_review', 'warning_closed', 'needs_response', 'under_review', 'won', 'lost')"`
+	EvidenceDueBy   *time.Time  `gorm:"type:timestamptz"`
+	// Evidence holds the evidence fields sent to Stripe so far.
+	Evidence            map[string]string `gorm:"type:jsonb;serializer:json"`
+	EvidenceSubmittedAt *time.Time        `gorm:"type:timestamptz"`
+	// PaymentStatusBefore is the status of the payment when the dispute opened,
+	// which it returns to if the dispute is won.
+	PaymentStatusBefore string    `gorm:"type:varchar(50)"`
+	CreatedAt           time.Time `gorm:"type:timestamptz;default:now()"`
+	UpdatedAt           time.Time `gorm:"type:timestamptz;default:now()"`
+}
+
+func (d *Dispute) BeforeCreate(tx *gorm.DB) (err error) {
+	d.ID = uuid.New()
+	return
+}
+
+// IsOpen reports whether the dispute has not been decided yet.
+func (d *Dispute) IsOpen() bool {
+	return slices.Contains(OpenDisputeStatuses, d.Status)
+}
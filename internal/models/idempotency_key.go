@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+const (
+	IdempotencyKeyStatusInProgress = "in_progress"
+	IdempotencyKeyStatusCompleted  = "completed"
+)
+
+// IdempotencyKey records a client-supplied key for a mutating RPC along with a
+// hash of the request it was first used with and, once completed, the response
+// that is replayed to retries. Keys are scoped to the RPC method.
+type IdempotencyKey struct {
+	Key         string    `gorm:"type:varchar(255);primaryKey"`
+	Method      string    `gorm:"type:varchar(100);primaryKey"`
+	RequestHash string    `gorm:"type:varchar(64);not null"`
+	Status      string    `gorm:"type:varchar(50);not null;default:'in_progress';check:status IN ('in_progress', 'completed')"`
+	Response    []byte    `gorm:"type:bytea"`
+	CreatedAt   time.Time `gorm:"type:timestamptz;default:now()"`
+	UpdatedAt   time.Time `gorm:"type:timestamptz;default:now()"`
+}
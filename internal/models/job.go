@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	JobRunStatusRunning   = "running"
+	JobRunStatusSucceeded = "succeeded"
+	JobRunStatusFailed    = "failed"
+)
+
+// JobLease gives one replica the right to run a background job until the lease
+// expires. The holder renews it while the job runs.
+type JobLease struct {
+	Name      string    `gorm:"type:varchar(100);primaryKey"`
+	Holder    string    `gorm:"type:varchar(255);not null"`
+	ExpiresAt time.Time `gorm:"type:timestamptz;not null"`
+	UpdatedAt time.Time `gorm:"type:timestamptz;default:now()"`
+}
+
+// JobRun records a single run of a background job and its outcome.
+type JobRun struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Job        string     `gorm:"type:varchar(100);not null;index:idx_job_runs_job_started_at"`
+	Holder     string     `gorm:"type:varchar(255);not null"`
+	Status     string     `gorm:"type:varchar(20);not null;default:'running';check:status IN ('running', 'succeeded', 'failed')"`
+	Error      string     `gorm:"type:text"`
+	StartedAt  time.Time  `gorm:"type:timestamptz;not null;index:idx_job_runs_job_started_at"`
+	FinishedAt *time.Time `gorm:"type:timestamptz"`
+}
+
+func (r *JobRun) BeforeCreate(tx *gorm.DB) (err error) {
+	r.ID = uuid.New()
+	return
+}
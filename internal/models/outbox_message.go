@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusDelivered = "delivered"
+	// OutboxStatusDeadLetter is a message given up on after too many failed
+	// deliveries. It no longer holds back later messages for its aggregate.
+	OutboxStatusDeadLetter = "dead_letter"
+)
+
+// Topics of outbox messages.
+const (
+	OutboxTopicOrderStatus = "order_status"
+)
+
+// OutboxMessage is a notification to another service that is written in the same
+// transaction as the change it describes and delivered afterwards by the outbox
+// dispatcher. Messages for the same aggregate are delivered in creation order.
+type OutboxMessage struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Topic         string     `gorm:"type:varchar(100);not null"`
+	AggregateID   string     `gorm:"type:varchar(255);not null;index"`
+	Payload       []byte     `gorm:"type:jsonb;not null"`
+	Status        string     `gorm:"type:varchar(50);not null;default:'pending';index;check:status IN ('pending', 'delivered', 'dead_letter')"`
+	Attempts      int        `gorm:"not null;default:0"`
+	LastError     string     `gorm:"type:text"`
+	NextAttemptAt time.Time  `gorm:"type:timestamptz;not null;default:now()"`
+	DeliveredAt   *time.Time `gorm:"type:timestamptz"`
+	CreatedAt     time.Time  `gorm:"type:timestamptz;default:now()"`
+}
+
+func (m *OutboxMessage) BeforeCreate(tx *gorm.DB) (err error) {
+	m.ID = uuid.New()
+	return
+}
+
+// OrderStatusUpdate is the payload of an order_status message.
+type OrderStatusUpdate struct {
+	OrderID string `json:"order_id"`
+	Status  string `json:"status"`
+}
@@ -3,21 +3,49 @@ package models
 import (
 	"time"
 
+	"github.com/PharmaKart/payment-svc/pkg/money"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Payment is a single attempt to pay for an order. An order can have many failed
+// or expired attempts but at most one successful one, which utils.MigrateDB
+// enforces with a partial unique index. Attempts started through Checkout are
+// created pending with the session ID as their transaction ID, which is replaced
+// by the PaymentIntent ID once the session is completed.
+//
+// Payments for prescription orders use manual capture: the card is only
+// authorized at checkout and the funds are captured once a pharmacist has
+// verified the prescription, before the provider releases the authorization at
+// AuthorizationExpiresAt. AuthorizationAlertedAt records that an authorization
+// close to expiring has been alerted on.
 type Payment struct {
-	ID            uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	OrderID       uuid.UUID `gorm:"not null;unique"`
-	CustomerID    uuid.UUID `gorm:"not null"`
-	TransactionID string    `gorm:"not null;unique"`
-	Amount        float64   `gorm:"not null"`
-	Status        string    `gorm:"type:varchar(50);not null;check:status IN ('pending', 'successful', 'failed')"`
-	CreatedAt     time.Time `gorm:"type:timestamptz;default:now()"`
+	ID                     uuid.UUID             `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OrderID                uuid.UUID             `gorm:"not null;index:idx_payments_order_attempts"`
+	CustomerID             uuid.UUID             `gorm:"not null"`
+	TransactionID          string                `gorm:"not null;unique"`
+	CheckoutSessionID      string                `gorm:"type:varchar(255);index"`
+	Amount                 money.Money           `gorm:"embedded;embeddedPrefix:amount_"`
+	Status                 string                `gorm:"type:varchar(50);not null"` // constrained to PaymentStatuses by utils.MigrateDB
+	FailureReason          string                `gorm:"type:text"`
+	CaptureMethod          string                `gorm:"type:varchar(20);not null;default:'automatic';check:capture_method IN ('automatic', 'manual')"`
+	AuthorizationExpiresAt *time.Time            `gorm:"type:timestamptz"`
+	AuthorizationAlertedAt *time.Time            `gorm:"type:timestamptz"`
+	Refunds                []Refund              `gorm:"foreignKey:PaymentID"`
+	History                []PaymentStatusChange `gorm:"foreignKey:PaymentID"`
+	CreatedAt              time.Time             `gorm:"type:timestamptz;default:now()"`
 }
 
+// Capture methods mirror Stripe's PaymentIntent capture_method.
+const (
+	CaptureMethodAutomatic = "automatic"
+	CaptureMethodManual    = "manual"
+)
+
 func (p *Payment) BeforeCreate(tx *gorm.DB) (err error) {
 	p.ID = uuid.New()
+	if p.CaptureMethod == "" {
+		p.CaptureMethod = CaptureMethodAutomatic
+	}
 	return
 }
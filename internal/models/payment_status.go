@@ -0,0 +1,77 @@
+package models
+
+import "slices"
+
+const (
+	PaymentStatusPending           = "pending"
+	PaymentStatusSuccessful        = "successful"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusExpired           = "expired"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+	// PaymentStatusManualReview holds a payment whose amount did not match the
+	// order, so the order is not marked paid until someone has looked at it.
+	PaymentStatusManualReview = "manual_review"
+	// PaymentStatusAuthorized holds a manual capture payment whose funds are
+	// reserved on the card but not yet captured.
+	PaymentStatusAuthorized = "authorized"
+	// PaymentStatusVoided is an authorization released without capturing it.
+	PaymentStatusVoided = "voided"
+	// PaymentStatusDisputed holds a payment the customer's bank is disputing, so
+	// the order is not fulfilled until the dispute is decided.
+	PaymentStatusDisputed = "disputed"
+	// PaymentStatusChargedBack is a payment whose dispute was lost, so its funds
+	// were returned to the customer.
+	PaymentStatusChargedBack = "charged_back"
+)
+
+// PaymentStatuses lists every status a payment can be in. The payments status
+// check constraint is generated from this list.
+var PaymentStatuses = []string{
+	PaymentStatusPending,
+	PaymentStatusSuccessful,
+	PaymentStatusFailed,
+	PaymentStatusExpired,
+	PaymentStatusPartiallyRefunded,
+	PaymentStatusRefunded,
+	PaymentStatusManualReview,
+	PaymentStatusAuthorized,
+	PaymentStatusVoided,
+	PaymentStatusDisputed,
+	PaymentStatusChargedBack,
+}
+
+// SuccessfulPaymentStatuses are the statuses of a payment that collected or is
+// holding money, including after it was refunded. An order can have at most one
+// payment in any of them.
+var SuccessfulPaymentStatuses = []string{
+	PaymentStatusSuccessful,
+	PaymentStatusPartiallyRefunded,
+	PaymentStatusRefunded,
+	PaymentStatusManualReview,
+	PaymentStatusAuthorized,
+	PaymentStatusDisputed,
+	PaymentStatusChargedBack,
+}
+
+// paymentTransitions maps each status to the statuses a payment may move to from it.
+// Statuses without an entry are final.
+var paymentTransitions = map[string][]string{
+	PaymentStatusPending:           {PaymentStatusSuccessful, PaymentStatusFailed, PaymentStatusExpired, PaymentStatusManualReview, PaymentStatusAuthorized},
+	PaymentStatusSuccessful:        {PaymentStatusPartiallyRefunded, PaymentStatusRefunded, PaymentStatusDisputed},
+	PaymentStatusPartiallyRefunded: {PaymentStatusRefunded, PaymentStatusDisputed},
+	PaymentStatusRefunded:          {PaymentStatusDisputed},
+	PaymentStatusManualReview:      {PaymentStatusSuccessful, PaymentStatusFailed, PaymentStatusPartiallyRefunded, PaymentStatusRefunded, PaymentStatusVoided, PaymentStatusExpired, PaymentStatusDisputed},
+	PaymentStatusAuthorized:        {PaymentStatusSuccessful, PaymentStatusManualReview, PaymentStatusVoided, PaymentStatusExpired},
+	PaymentStatusDisputed:          {PaymentStatusSuccessful, PaymentStatusPartiallyRefunded, PaymentStatusRefunded, PaymentStatusManualReview, PaymentStatusChargedBack},
+}
+
+// IsValidPaymentStatus reports whether status is a known payment status.
+func IsValidPaymentStatus(status string) bool {
+	return slices.Contains(PaymentStatuses, status)
+}
+
+// CanTransitionPayment reports whether a payment may move from one status to another.
+func CanTransitionPayment(from string, to string) bool {
+	return slices.Contains(paymentTransitions[from], to)
+}
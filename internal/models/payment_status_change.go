@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Sources through which a payment can be changed.
+const (
+	ChangeSourceWebhook = "webhook"
+	ChangeSourceRPC     = "rpc"
+	ChangeSourceJob     = "job"
+)
+
+// Actions recorded in a payment's status history.
+const (
+	PaymentActionCreated                 = "created"
+	PaymentActionStored                  = "stored"
+	PaymentActionRefundRequested         = "refund_requested"
+	PaymentActionRefunded                = "refunded"
+	PaymentActionRefundApprovalRequested = "refund_approval_requested"
+	PaymentActionRefundApproved          = "refund_approved"
+	PaymentActionRefundRejected          = "refund_rejected"
+	PaymentActionExpired                 = "expired"
+	PaymentActionAuthorized              = "authorized"
+	PaymentActionCaptured                = "captured"
+	PaymentActionVoided                  = "voided"
+	PaymentActionDisputed                = "disputed"
+	PaymentActionDisputeEvidence         = "dispute_evidence"
+	PaymentActionDisputeClosed           = "dispute_closed"
+	PaymentActionReviewResolved          = "review_resolved"
+)
+
+// UnknownActorID is recorded for changes whose caller did not say who they are.
+const UnknownActorID = "unknown"
+
+// Actor identifies who changed a payment and through which source.
+type Actor struct {
+	ID     string
+	Source string
+}
+
+// Change describes a change made by the actor, to be recorded by the repository.
+func (a Actor) Change(action string, note string) PaymentStatusChange {
+	return PaymentStatusChange{
+		Action:  action,
+		ActorID: a.ID,
+		Source:  a.Source,
+		Note:    note,
+	}
+}
+
+// PaymentStatusChange is an immutable entry in a payment's history. Rows are only
+// ever inserted; a trigger installed by utils.MigrateDB rejects updates and deletes.
+type PaymentStatusChange struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PaymentID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	Action     string    `gorm:"type:varchar(50);not null"`
+	FromStatus string    `gorm:"type:varchar(50)"`
+	ToStatus   string    `gorm:"type:varchar(50);not null"`
+	ActorID    string    `gorm:"type:varchar(255);not null"`
+	Source     string    `gorm:"type:varchar(50);not null;check:source IN ('webhook', 'rpc', 'job')"`
+	Note       string    `gorm:"type:text"`
+	CreatedAt  time.Time `gorm:"type:timestamptz;default:now()"`
+
+	// OrderStatus, when set, is delivered to the order service through the outbox
+	// in the same transaction as the change. It is not stored on the change itself.
+	OrderStatus string `gorm:"-"`
+}
+
+// NotifyOrder returns the change with an order status to send to the order service.
+func (c PaymentStatusChange) NotifyOrder(orderStatus string) PaymentStatusChange {
+	c.OrderStatus = orderStatus
+	return c
+}
+
+func (c *PaymentStatusChange) BeforeCreate(tx *gorm.DB) (err error) {
+	c.ID = uuid.New()
+	return
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCanTransitionPayment(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		// Checkout outcomes.
+		{PaymentStatusPending, PaymentStatusSuccessful, true},
+		{PaymentStatusPending, PaymentStatusFailed, true},
+		{PaymentStatusPending, PaymentStatusExpired, true},
+		{PaymentStatusPending, PaymentStatusManualReview, true},
+		{PaymentStatusPending, PaymentStatusAuthorized, true},
+		{PaymentStatusPending, PaymentStatusRefunded, false},
+		{PaymentStatusPending, PaymentStatusDisputed, false},
+
+		// Refunds only follow a collected payment.
+		{PaymentStatusSuccessful, PaymentStatusPartiallyRefunded, true},
+		{PaymentStatusSuccessful, PaymentStatusRefunded, true},
+		{PaymentStatusPartiallyRefunded, PaymentStatusRefunded, true},
+		{PaymentStatusFailed, PaymentStatusRefunded, false},
+		{PaymentStatusExpired, PaymentStatusRefunded, false},
+		{PaymentStatusAuthorized, PaymentStatusRefunded, false},
+
+		// Refunds are never undone.
+		{PaymentStatusRefunded, PaymentStatusSuccessful, false},
+		{PaymentStatusRefunded, PaymentStatusPartiallyRefunded, false},
+		{PaymentStatusPartiallyRefunded, PaymentStatusSuccessful, false},
+		{PaymentStatusSuccessful, PaymentStatusPending, false},
+
+		// Failed attempts stay failed; a retry is a new payment.
+		{PaymentStatusFailed, PaymentStatusSuccessful, false},
+		{PaymentStatusExpired, PaymentStatusSuccessful, false},
+		{PaymentStatusVoided, PaymentStatusSuccessful, false},
+
+		// Manual capture.
+		{PaymentStatusAuthorized, PaymentStatusSuccessful, true},
+		{PaymentStatusAuthorized, PaymentStatusVoided, true},
+		{PaymentStatusAuthorized, PaymentStatusExpired, true},
+		{PaymentStatusAuthorized, PaymentStatusManualReview, true},
+		{PaymentStatusSuccessful, PaymentStatusVoided, false},
+
+		// Manual review is resolved by an operator.
+		{PaymentStatusManualReview, PaymentStatusSuccessful, true},
+		{PaymentStatusManualReview, PaymentStatusRefunded, true},
+		{PaymentStatusManualReview, PaymentStatusPending, false},
+
+		// Disputes.
+		{PaymentStatusSuccessful, PaymentStatusDisputed, true},
+		{PaymentStatusRefunded, PaymentStatusDisputed, true},
+		{PaymentStatusDisputed, PaymentStatusSuccessful, true},
+		{PaymentStatusDisputed, PaymentStatusChargedBack, true},
+		{PaymentStatusSuccessful, PaymentStatusChargedBack, false},
+		{PaymentStatusFailed, PaymentStatusDisputed, false},
+		{PaymentStatusDisputed, PaymentStatusPending, false},
+		{PaymentStatusChargedBack, PaymentStatusSuccessful, false},
+		{PaymentStatusChargedBack, PaymentStatusDisputed, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := CanTransitionPayment(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransitionPayment(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentTransitionsUseKnownStatuses(t *testing.T) {
+	for from, targets := range paymentTransitions {
+		if !IsValidPaymentStatus(from) {
+			t.Errorf("transitions from unknown status %q", from)
+		}
+		for _, to := range targets {
+			if !IsValidPaymentStatus(to) {
+				t.Errorf("transition %q -> unknown status %q", from, to)
+			}
+			if to == from {
+				t.Errorf("transition %q -> %q does not change the status", from, to)
+			}
+		}
+	}
+}
+
+func TestFinalPaymentStatuses(t *testing.T) {
+	for _, status := range []string{PaymentStatusFailed, PaymentStatusExpired, PaymentStatusVoided, PaymentStatusChargedBack} {
+		for _, to := range PaymentStatuses {
+			if CanTransitionPayment(status, to) {
+				t.Errorf("final status %q can move to %q", status, to)
+			}
+		}
+	}
+}
+
+func TestSuccessfulPaymentStatusesAreKnown(t *testing.T) {
+	for _, status := range SuccessfulPaymentStatuses {
+		if !slices.Contains(PaymentStatuses, status) {
+			t.Errorf("successful status %q is not a payment status", status)
+		}
+	}
+}
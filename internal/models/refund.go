@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Refund statuses mirror the statuses reported by Stripe for a refund.
+const (
+	RefundStatusPending        = "pending"
+	RefundStatusRequiresAction = "requires_action"
+	RefundStatusSucceeded      = "succeeded"
+	RefundStatusFailed         = "failed"
+	RefundStatusCanceled       = "canceled"
+)
+
+// Refund reason codes accepted by RefundPayment.
+const (
+	RefundReasonRequestedByCustomer = "requested_by_customer"
+	RefundReasonOutOfStock          = "out_of_stock"
+	RefundReasonShipping            = "shipping"
+	RefundReasonDuplicate           = "duplicate"
+	RefundReasonFraudulent          = "fraudulent"
+	RefundReasonOther               = "other"
+)
+
+var RefundReasons = []string{
+	RefundReasonRequestedByCustomer,
+	RefundReasonOutOfStock,
+	RefundReasonShipping,
+	RefundReasonDuplicate,
+	RefundReasonFraudulent,
+	RefundReasonOther,
+}
+
+type Refund struct {
+	ID             uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PaymentID      uuid.UUID   `gorm:"type:uuid;not null;index"`
+	StripeRefundID string      `gorm:"type:varchar(255);index"`
+	Amount         money.Money `gorm:"embedded;embeddedPrefix:amount_"`
+	Reason         string      `gorm:"type:varchar(50);not null"`
+	Status         string      `gorm:"type:varchar(50);not null;check:status IN ('pending', 'requires_action', 'succeeded', 'failed', 'canceled')"`
+	FailureReason  string      `gorm:"type:text"`
+	CreatedAt      time.Time   `gorm:"type:timestamptz;default:now()"`
+	UpdatedAt      time.Time   `gorm:"type:timestamptz;default:now()"`
+}
+
+func (r *Refund) BeforeCreate(tx *gorm.DB) (err error) {
+	r.ID = uuid.New()
+	return
+}
+
+// IsOpen reports whether the refund still counts against the refundable balance.
+func (r *Refund) IsOpen() bool {
+	return r.Status != RefundStatusFailed && r.Status != RefundStatusCanceled
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	RefundApprovalStatusPending  = "pending"
+	RefundApprovalStatusApproved = "approved"
+	RefundApprovalStatusRejected = "rejected"
+)
+
+// RefundApproval is a refund above the approval threshold waiting for a second
+// person to approve it. The refund is only issued once it is approved, and the
+// requester, the approver and their comment are kept for audit.
+type RefundApproval struct {
+	ID          uuid.UUID   `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PaymentID   uuid.UUID   `gorm:"type:uuid;not null;index"`
+	Amount      money.Money `gorm:"embedded;embeddedPrefix:amount_"`
+	Reason      string      `gorm:"type:varchar(50);not null"`
+	Status      string      `gorm:"type:varchar(20);not null;default:'pending';index;check:status IN ('pending', 'approved', 'rejected')"`
+	RequestedBy string      `gorm:"type:varchar(255);not null"`
+	DecidedBy   string      `gorm:"type:varchar(255)"`
+	DecidedAt   *time.Time  `gorm:"type:timestamptz"`
+	Comment     string      `gorm:"type:text"`
+	// RefundID is the refund issued once the request was approved.
+	RefundID  *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt time.Time  `gorm:"type:timestamptz;default:now()"`
+	UpdatedAt time.Time  `gorm:"type:timestamptz;default:now()"`
+}
+
+func (a *RefundApproval) BeforeCreate(tx *gorm.DB) (err error) {
+	a.ID = uuid.New()
+	return
+}
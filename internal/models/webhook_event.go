@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Pending events are processed once NextAttemptAt has passed, including events
+// whose earlier attempts failed. Events that keep failing are moved to failed,
+// where they stay until they are replayed.
+const (
+	WebhookEventStatusPending    = "pending"
+	WebhookEventStatusProcessing = "processing"
+	WebhookEventStatusProcessed  = "processed"
+	WebhookEventStatusFailed     = "failed"
+)
+
+// WebhookEvent is an inbox entry for a Stripe event, keyed by the Stripe event ID.
+type WebhookEvent struct {
+	ID        string `gorm:"type:varchar(255);primaryKey"`
+	Type      string `gorm:"type:varchar(100);not null"`
+	Payload   []byte `gorm:"type:jsonb;not null"`
+	Status    string `gorm:"type:varchar(50);not null;default:'pending';check:status IN ('pending', 'processing', 'processed', 'failed')"`
+	Attempts  int    `gorm:"not null;default:0"`
+	LastError string `gorm:"type:text"`
+	// NextAttemptAt is when a pending event is due; nil means straight away.
+	NextAttemptAt *time.Time `gorm:"type:timestamptz;index"`
+	ProcessedAt   *time.Time `gorm:"type:timestamptz"`
+	CreatedAt     time.Time  `gorm:"type:timestamptz;default:now()"`
+	UpdatedAt     time.Time  `gorm:"type:timestamptz;default:now()"`
+}
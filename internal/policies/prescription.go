@@ -0,0 +1,149 @@
+package policies
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/PharmaKart/payment-svc/internal/proto"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+)
+
+// PrescriptionPolicy decides whether an order's prescription allows it to be
+// paid for.
+type PrescriptionPolicy interface {
+	// Check returns why the order cannot be paid for yet, keyed by the field or
+	// item each reason concerns, or nil if nothing blocks it.
+	Check(order *proto.GetOrderResponse) map[string]string
+}
+
+// PrescriptionRule lists which items of an order need a prescription and which
+// prescription statuses allow them to be sold.
+type PrescriptionRule struct {
+	// ApprovedStatuses are the prescription statuses that allow checkout.
+	ApprovedStatuses []string `json:"approved_statuses"`
+	// PrescriptionProducts need a prescription even when the order service does
+	// not flag them.
+	PrescriptionProducts []string `json:"prescription_products"`
+	// ExemptProducts can be sold without a prescription even when the order
+	// service flags them.
+	ExemptProducts []string `json:"exempt_products"`
+}
+
+// PrescriptionRules holds the default rule and the rules of provinces that
+// differ from it, keyed by province code.
+type PrescriptionRules struct {
+	Default   PrescriptionRule            `json:"default"`
+	Provinces map[string]PrescriptionRule `json:"provinces"`
+}
+
+// DefaultPrescriptionRules requires an approved prescription for every item the
+// order service flags, in every province.
+func DefaultPrescriptionRules() PrescriptionRules {
+	return PrescriptionRules{
+		Default: PrescriptionRule{
+			ApprovedStatuses: []string{"approved"},
+		},
+	}
+}
+
+type rulesPolicy struct {
+	rules PrescriptionRules
+}
+
+// NewPrescriptionPolicy returns a policy that applies the given rules. Province
+// codes and approved statuses are matched case-insensitively.
+func NewPrescriptionPolicy(rules PrescriptionRules) PrescriptionPolicy {
+	rules.Default.ApprovedStatuses = lowerAll(rules.Default.ApprovedStatuses)
+
+	provinces := make(map[string]PrescriptionRule, len(rules.Provinces))
+	for province, rule := range rules.Provinces {
+		rule.ApprovedStatuses = lowerAll(rule.ApprovedStatuses)
+		provinces[strings.ToUpper(province)] = rule
+	}
+	rules.Provinces = provinces
+
+	return &rulesPolicy{rules: rules}
+}
+
+// New returns the prescription policy described by the configured rules file, or
+// the default rules when none is configured.
+func New(cfg *config.Config) (PrescriptionPolicy, error) {
+	if cfg.PrescriptionPolicyFile == "" {
+		return NewPrescriptionPolicy(DefaultPrescriptionRules()), nil
+	}
+
+	data, err := os.ReadFile(cfg.PrescriptionPolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading prescription policy: %w", err)
+	}
+
+	rules := DefaultPrescriptionRules()
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing prescription policy %s: %w", cfg.PrescriptionPolicyFile, err)
+	}
+	if len(rules.Default.ApprovedStatuses) == 0 {
+		return nil, fmt.Errorf("prescription policy %s has no approved statuses", cfg.PrescriptionPolicyFile)
+	}
+
+	return NewPrescriptionPolicy(rules), nil
+}
+
+func (p *rulesPolicy) Check(order *proto.GetOrderResponse) map[string]string {
+	rule := p.ruleFor(order.GetProvince())
+
+	blocking := map[string]string{}
+	for _, item := range order.Items {
+		if p.requiresPrescription(rule, item) {
+			blocking[fmt.Sprintf("items[%s]", item.ProductId)] = fmt.Sprintf("%s requires an approved prescription", item.ProductName)
+		}
+	}
+	if len(blocking) == 0 {
+		return nil
+	}
+
+	status := strings.ToLower(order.GetPrescriptionStatus())
+	switch {
+	case order.GetPrescriptionUrl() == "":
+		blocking["prescription_url"] = "A prescription is required for this order"
+	case status == "":
+		blocking["prescription_status"] = "The prescription has not been reviewed"
+	case !slices.Contains(rule.ApprovedStatuses, status):
+		blocking["prescription_status"] = fmt.Sprintf("The prescription is %s, it must be one of: %s", status, strings.Join(rule.ApprovedStatuses, ", "))
+	default:
+		return nil
+	}
+
+	return blocking
+}
+
+// ruleFor returns the rule of the province, falling back to the default rule for
+// provinces without their own. A province rule without approved statuses takes
+// them from the default rule.
+func (p *rulesPolicy) ruleFor(province string) PrescriptionRule {
+	rule, ok := p.rules.Provinces[strings.ToUpper(province)]
+	if !ok {
+		return p.rules.Default
+	}
+	if len(rule.ApprovedStatuses) == 0 {
+		rule.ApprovedStatuses = p.rules.Default.ApprovedStatuses
+	}
+	return rule
+}
+
+func (p *rulesPolicy) requiresPrescription(rule PrescriptionRule, item *proto.OrderItem) bool {
+	if slices.Contains(rule.ExemptProducts, item.ProductId) {
+		return false
+	}
+	return item.RequiresPrescription || slices.Contains(rule.PrescriptionProducts, item.ProductId)
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, 0, len(values))
+	for _, value := range values {
+		lowered = append(lowered, strings.ToLower(strings.TrimSpace(value)))
+	}
+	return lowered
+}
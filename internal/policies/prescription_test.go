@@ -0,0 +1,66 @@
+package policies
+
+import (
+	"testing"
+
+	"github.com/PharmaKart/payment-svc/internal/proto"
+)
+
+func prescriptionOrder(province, prescriptionURL, prescriptionStatus string) *proto.GetOrderResponse {
+	return &proto.GetOrderResponse{
+		Items: []*proto.OrderItem{
+			{ProductId: "amoxicillin", ProductName: "Amoxicillin", Quantity: 1, Price: 12, RequiresPrescription: true},
+			{ProductId: "vitamin-d", ProductName: "Vitamin D", Quantity: 1, Price: 8},
+		},
+		PrescriptionUrl:    &prescriptionURL,
+		PrescriptionStatus: &prescriptionStatus,
+		Province:           &province,
+	}
+}
+
+func TestPrescriptionPolicyCheck(t *testing.T) {
+	policy := NewPrescriptionPolicy(PrescriptionRules{
+		Default: PrescriptionRule{
+			ApprovedStatuses: []string{"Approved", " VERIFIED "},
+		},
+		Provinces: map[string]PrescriptionRule{
+			"qc": {
+				ApprovedStatuses:     []string{"Pharmacist_Approved"},
+				PrescriptionProducts: []string{"vitamin-d"},
+			},
+			"bc": {
+				ExemptProducts: []string{"amoxicillin"},
+			},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		order    *proto.GetOrderResponse
+		blocking []string
+	}{
+		{"approved", prescriptionOrder("ON", "https://rx.test/1", "approved"), nil},
+		{"configured statuses are matched case-insensitively", prescriptionOrder("ON", "https://rx.test/1", "verified"), nil},
+		{"order status is matched case-insensitively", prescriptionOrder("ON", "https://rx.test/1", "APPROVED"), nil},
+		{"no prescription", prescriptionOrder("ON", "", ""), []string{"items[amoxicillin]", "prescription_url"}},
+		{"not reviewed", prescriptionOrder("ON", "https://rx.test/1", ""), []string{"items[amoxicillin]", "prescription_status"}},
+		{"rejected", prescriptionOrder("ON", "https://rx.test/1", "rejected"), []string{"items[amoxicillin]", "prescription_status"}},
+		{"province statuses", prescriptionOrder("QC", "https://rx.test/1", "pharmacist_approved"), nil},
+		{"province does not accept the default statuses", prescriptionOrder("qc", "https://rx.test/1", "approved"), []string{"items[amoxicillin]", "items[vitamin-d]", "prescription_status"}},
+		{"province exempts a product", prescriptionOrder("BC", "", ""), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.Check(tt.order)
+			if len(got) != len(tt.blocking) {
+				t.Fatalf("Check() = %v, want %v blocking", got, tt.blocking)
+			}
+			for _, field := range tt.blocking {
+				if _, ok := got[field]; !ok {
+					t.Errorf("Check() = %v, missing %s", got, field)
+				}
+			}
+		})
+	}
+}
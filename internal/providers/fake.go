@@ -0,0 +1,320 @@
+package providers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/google/uuid"
+)
+
+// Outcomes the fake provider can simulate when a checkout session is completed.
+const (
+	// FakeOutcomeSuccess captures the payment immediately.
+	FakeOutcomeSuccess = "success"
+	// FakeOutcomeDecline declines the payment and leaves the session open.
+	FakeOutcomeDecline = "decline"
+	// FakeOutcomeAsync completes the session but leaves the payment processing,
+	// as with a delayed method such as pre-authorized debit.
+	FakeOutcomeAsync = "async"
+)
+
+const (
+	// fakeSessionLifetime matches the default lifetime of a Stripe Checkout Session.
+	fakeSessionLifetime = 24 * time.Hour
+	// fakeAuthorizationWindow matches how long Stripe holds a card authorization.
+	fakeAuthorizationWindow = 7 * 24 * time.Hour
+)
+
+// FakeProvider is an in-memory PaymentProvider for running the service without
+// Stripe. IDs are assigned from a counter behind a prefix picked when the
+// provider is created, so they stay unique across restarts of the service while
+// its payments are kept in the database. Every session and refund resolves to
+// the configured outcome.
+type FakeProvider struct {
+	mu       sync.Mutex
+	outcome  string
+	prefix   string
+	sequence int
+	sessions map[string]*CheckoutSession
+	intents  map[string]*PaymentIntent
+	manual   map[string]bool
+	refunds  map[string]*Refund
+	// Idempotency keys are scoped to the operation they were used for, as at
+	// Stripe, mapped to the ID of the object they created or changed.
+	sessionKeys map[string]string
+	captureKeys map[string]string
+	cancelKeys  map[string]string
+	refundKeys  map[string]string
+	now         func() time.Time
+}
+
+func NewFakeProvider(outcome string) (*FakeProvider, error) {
+	switch outcome {
+	case FakeOutcomeSuccess, FakeOutcomeDecline, FakeOutcomeAsync:
+	default:
+		return nil, fmt.Errorf("unknown fake provider outcome %q", outcome)
+	}
+
+	return &FakeProvider{
+		outcome:     outcome,
+		prefix:      uuid.NewString()[:8],
+		sessions:    map[string]*CheckoutSession{},
+		intents:     map[string]*PaymentIntent{},
+		manual:      map[string]bool{},
+		refunds:     map[string]*Refund{},
+		sessionKeys: map[string]string{},
+		captureKeys: map[string]string{},
+		cancelKeys:  map[string]string{},
+		refundKeys:  map[string]string{},
+		now:         time.Now,
+	}, nil
+}
+
+func (p *FakeProvider) CreateCheckoutSession(req CheckoutSessionRequest) (*CheckoutSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id, ok := p.sessionKeys[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		return copySession(p.sessions[id]), nil
+	}
+
+	amount := money.New(0, req.Currency)
+	for _, item := range req.LineItems {
+		var err error
+		if amount, err = amount.Add(item.UnitAmount.Mul(item.Quantity)); err != nil {
+			return nil, err
+		}
+	}
+
+	p.sequence++
+	session := &CheckoutSession{
+		ID:              fmt.Sprintf("cs_fake_%s_%06d", p.prefix, p.sequence),
+		URL:             fmt.Sprintf("https://checkout.fake.local/pay/cs_fake_%s_%06d", p.prefix, p.sequence),
+		Status:          models.CheckoutSessionStatusOpen,
+		PaymentIntentID: fmt.Sprintf("pi_fake_%s_%06d", p.prefix, p.sequence),
+		Amount:          amount,
+		ExpiresAt:       p.now().Add(fakeSessionLifetime),
+	}
+	p.sessions[session.ID] = session
+	p.intents[session.PaymentIntentID] = &PaymentIntent{
+		ID:               session.PaymentIntentID,
+		Status:           "requires_payment_method",
+		AmountReceived:   money.New(0, req.Currency),
+		AmountCapturable: money.New(0, req.Currency),
+		Metadata:         req.Metadata,
+	}
+	p.manual[session.PaymentIntentID] = req.ManualCapture
+
+	if req.IdempotencyKey != "" {
+		p.sessionKeys[req.IdempotencyKey] = session.ID
+	}
+
+	return copySession(session), nil
+}
+
+func (p *FakeProvider) GetCheckoutSession(sessionID string) (*CheckoutSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	session, ok := p.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: checkout session %s", ErrNotFound, sessionID)
+	}
+	return copySession(session), nil
+}
+
+func (p *FakeProvider) ExpireCheckoutSession(sessionID string) (*CheckoutSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	session, ok := p.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: checkout session %s", ErrNotFound, sessionID)
+	}
+	if session.Status != models.CheckoutSessionStatusOpen {
+		return nil, fmt.Errorf("checkout session %s is %s and cannot be expired", sessionID, session.Status)
+	}
+
+	session.Status = models.CheckoutSessionStatusExpired
+	return copySession(session), nil
+}
+
+// CompleteCheckoutSession simulates the customer paying for the session, applying
+// the configured outcome. A successful manual capture session leaves its payment
+// authorized until it is captured or canceled. A declined payment leaves the
+// session open, as Stripe does, so the customer can try again until it expires.
+// When the service runs with the fake provider, it is called through the
+// handler returned by handlers.NewFakeCheckoutHandler.
+func (p *FakeProvider) CompleteCheckoutSession(sessionID string) (*CheckoutSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	session, ok := p.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: checkout session %s", ErrNotFound, sessionID)
+	}
+	if session.Status != models.CheckoutSessionStatusOpen {
+		return nil, fmt.Errorf("checkout session %s is %s and cannot be completed", sessionID, session.Status)
+	}
+
+	intent := p.intents[session.PaymentIntentID]
+	switch p.outcome {
+	case FakeOutcomeSuccess:
+		session.Status = models.CheckoutSessionStatusComplete
+		if p.manual[intent.ID] {
+			intent.Status = "requires_capture"
+			intent.AmountCapturable = session.Amount
+			intent.CaptureBefore = p.now().Add(fakeAuthorizationWindow)
+		} else {
+			intent.Status = "succeeded"
+			intent.AmountReceived = session.Amount
+		}
+	case FakeOutcomeDecline:
+		intent.Status = "requires_payment_method"
+	case FakeOutcomeAsync:
+		session.Status = models.CheckoutSessionStatusComplete
+		intent.Status = "processing"
+	}
+
+	return copySession(session), nil
+}
+
+func (p *FakeProvider) GetPaymentIntent(paymentIntentID string) (*PaymentIntent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[paymentIntentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: payment intent %s", ErrNotFound, paymentIntentID)
+	}
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (p *FakeProvider) CapturePaymentIntent(paymentIntentID string, idempotencyKey string) (*PaymentIntent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[paymentIntentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: payment intent %s", ErrNotFound, paymentIntentID)
+	}
+	if id, ok := p.captureKeys[idempotencyKey]; !ok || idempotencyKey == "" || id != paymentIntentID {
+		if intent.Status != "requires_capture" {
+			return nil, fmt.Errorf("payment intent %s is %s and cannot be captured", intent.ID, intent.Status)
+		}
+
+		intent.Status = "succeeded"
+		intent.AmountReceived = intent.AmountCapturable
+		intent.AmountCapturable = money.New(0, intent.AmountCapturable.Currency)
+		if idempotencyKey != "" {
+			p.captureKeys[idempotencyKey] = intent.ID
+		}
+	}
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (p *FakeProvider) CancelPaymentIntent(paymentIntentID string, idempotencyKey string) (*PaymentIntent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[paymentIntentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: payment intent %s", ErrNotFound, paymentIntentID)
+	}
+	if id, ok := p.cancelKeys[idempotencyKey]; !ok || idempotencyKey == "" || id != paymentIntentID {
+		if intent.Status != "requires_capture" && intent.Status != "requires_payment_method" {
+			return nil, fmt.Errorf("payment intent %s is %s and cannot be canceled", intent.ID, intent.Status)
+		}
+
+		intent.Status = "canceled"
+		intent.AmountCapturable = money.New(0, intent.AmountCapturable.Currency)
+		if idempotencyKey != "" {
+			p.cancelKeys[idempotencyKey] = intent.ID
+		}
+	}
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (p *FakeProvider) CreateRefund(req RefundRequest) (*Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id, ok := p.refundKeys[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		copied := *p.refunds[id]
+		return &copied, nil
+	}
+
+	intent, ok := p.intents[req.PaymentIntentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: payment intent %s", ErrNotFound, req.PaymentIntentID)
+	}
+	if intent.Status != "succeeded" {
+		return nil, fmt.Errorf("payment intent %s is %s and cannot be refunded", intent.ID, intent.Status)
+	}
+
+	p.sequence++
+	refund := &Refund{
+		ID:              fmt.Sprintf("re_fake_%s_%06d", p.prefix, p.sequence),
+		PaymentIntentID: intent.ID,
+		Amount:          req.Amount,
+		Metadata:        req.Metadata,
+	}
+
+	switch p.outcome {
+	case FakeOutcomeSuccess:
+		refund.Status = models.RefundStatusSucceeded
+	case FakeOutcomeDecline:
+		refund.Status = models.RefundStatusFailed
+		refund.FailureReason = "unknown"
+	case FakeOutcomeAsync:
+		refund.Status = models.RefundStatusPending
+	}
+
+	p.refunds[refund.ID] = refund
+	if req.IdempotencyKey != "" {
+		p.refundKeys[req.IdempotencyKey] = refund.ID
+	}
+
+	copied := *refund
+	return &copied, nil
+}
+
+func (p *FakeProvider) GetRefund(refundID string) (*Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	refund, ok := p.refunds[refundID]
+	if !ok {
+		return nil, fmt.Errorf("%w: refund %s", ErrNotFound, refundID)
+	}
+	copied := *refund
+	return &copied, nil
+}
+
+// UpdateDisputeEvidence accepts evidence for any dispute, since the fake
+// provider never raises disputes itself. Submitted evidence puts the dispute
+// under review.
+func (p *FakeProvider) UpdateDisputeEvidence(req DisputeEvidenceRequest) (*Dispute, error) {
+	dispute := &Dispute{
+		ID:     req.DisputeID,
+		Status: models.DisputeStatusNeedsResponse,
+	}
+	if req.Submit {
+		dispute.Status = models.DisputeStatusUnderReview
+	}
+	return dispute, nil
+}
+
+func copySession(session *CheckoutSession) *CheckoutSession {
+	copied := *session
+	return &copied
+}
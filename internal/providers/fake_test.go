@@ -0,0 +1,176 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+)
+
+func newFakeSession(t *testing.T, p *FakeProvider, manualCapture bool, idempotencyKey string) *CheckoutSession {
+	t.Helper()
+
+	session, err := p.CreateCheckoutSession(CheckoutSessionRequest{
+		OrderID:  "order",
+		Currency: "cad",
+		LineItems: []LineItem{
+			{Name: "Item", UnitAmount: money.New(1250, "cad"), Quantity: 2},
+		},
+		ManualCapture:  manualCapture,
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession: %v", err)
+	}
+	return session
+}
+
+func TestFakeProviderCompleteCheckoutSession(t *testing.T) {
+	tests := []struct {
+		name           string
+		outcome        string
+		manualCapture  bool
+		sessionStatus  string
+		intentStatus   string
+		amountReceived int64
+	}{
+		{"success", FakeOutcomeSuccess, false, models.CheckoutSessionStatusComplete, "succeeded", 2500},
+		{"success with manual capture", FakeOutcomeSuccess, true, models.CheckoutSessionStatusComplete, "requires_capture", 0},
+		{"decline", FakeOutcomeDecline, false, models.CheckoutSessionStatusOpen, "requires_payment_method", 0},
+		{"async", FakeOutcomeAsync, false, models.CheckoutSessionStatusComplete, "processing", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewFakeProvider(tt.outcome)
+			if err != nil {
+				t.Fatal(err)
+			}
+			created := newFakeSession(t, p, tt.manualCapture, "")
+
+			session, err := p.CompleteCheckoutSession(created.ID)
+			if err != nil {
+				t.Fatalf("CompleteCheckoutSession: %v", err)
+			}
+			if session.Status != tt.sessionStatus {
+				t.Errorf("session status = %q, want %q", session.Status, tt.sessionStatus)
+			}
+
+			intent, err := p.GetPaymentIntent(created.PaymentIntentID)
+			if err != nil {
+				t.Fatalf("GetPaymentIntent: %v", err)
+			}
+			if intent.Status != tt.intentStatus {
+				t.Errorf("intent status = %q, want %q", intent.Status, tt.intentStatus)
+			}
+			if intent.AmountReceived.Minor != tt.amountReceived {
+				t.Errorf("amount received = %d, want %d", intent.AmountReceived.Minor, tt.amountReceived)
+			}
+			if tt.manualCapture && intent.AmountCapturable.Minor != 2500 {
+				t.Errorf("amount capturable = %d, want 2500", intent.AmountCapturable.Minor)
+			}
+		})
+	}
+}
+
+func TestFakeProviderCompleteCheckoutSessionOnlyOnce(t *testing.T) {
+	p, _ := NewFakeProvider(FakeOutcomeSuccess)
+	created := newFakeSession(t, p, false, "")
+
+	if _, err := p.CompleteCheckoutSession(created.ID); err != nil {
+		t.Fatalf("CompleteCheckoutSession: %v", err)
+	}
+	if _, err := p.CompleteCheckoutSession(created.ID); err == nil {
+		t.Error("completing a completed session succeeded")
+	}
+	if _, err := p.CompleteCheckoutSession("cs_fake_missing"); !IsNotFound(err) {
+		t.Errorf("completing an unknown session = %v, want not found", err)
+	}
+}
+
+func TestFakeProviderIdempotencyKeysAreScopedToTheOperation(t *testing.T) {
+	p, _ := NewFakeProvider(FakeOutcomeSuccess)
+
+	// The same key creates a session, then captures and later cancels another
+	// payment, each of which must really happen.
+	first := newFakeSession(t, p, true, "key")
+	if again := newFakeSession(t, p, true, "key"); again.ID != first.ID {
+		t.Fatalf("retried session = %s, want %s", again.ID, first.ID)
+	}
+	if _, err := p.CompleteCheckoutSession(first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	captured, err := p.CapturePaymentIntent(first.PaymentIntentID, "key")
+	if err != nil {
+		t.Fatalf("CapturePaymentIntent: %v", err)
+	}
+	if captured.Status != "succeeded" || captured.AmountReceived.Minor != 2500 {
+		t.Errorf("captured intent = %s with %s received, want succeeded with 25.00 CAD", captured.Status, captured.AmountReceived)
+	}
+	if retried, err := p.CapturePaymentIntent(first.PaymentIntentID, "key"); err != nil || retried.Status != "succeeded" {
+		t.Errorf("retried capture = %v, %v, want the captured intent", retried, err)
+	}
+
+	second := newFakeSession(t, p, true, "other")
+	if _, err := p.CompleteCheckoutSession(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := p.CancelPaymentIntent(second.PaymentIntentID, "key")
+	if err != nil {
+		t.Fatalf("CancelPaymentIntent: %v", err)
+	}
+	if canceled.Status != "canceled" {
+		t.Errorf("canceled intent status = %q, want canceled", canceled.Status)
+	}
+
+	refund, err := p.CreateRefund(RefundRequest{PaymentIntentID: first.PaymentIntentID, Amount: money.New(500, "cad"), IdempotencyKey: "key"})
+	if err != nil {
+		t.Fatalf("CreateRefund: %v", err)
+	}
+	if refund.Status != models.RefundStatusSucceeded || refund.Amount.Minor != 500 {
+		t.Errorf("refund = %s of %s, want succeeded of 5.00 CAD", refund.Status, refund.Amount)
+	}
+	if retried, err := p.CreateRefund(RefundRequest{PaymentIntentID: first.PaymentIntentID, Amount: money.New(500, "cad"), IdempotencyKey: "key"}); err != nil || retried.ID != refund.ID {
+		t.Errorf("retried refund = %v, %v, want %s", retried, err, refund.ID)
+	}
+}
+
+func TestFakeProviderRefundOutcomes(t *testing.T) {
+	tests := []struct {
+		outcome string
+		status  string
+	}{
+		{FakeOutcomeSuccess, models.RefundStatusSucceeded},
+		{FakeOutcomeDecline, models.RefundStatusFailed},
+		{FakeOutcomeAsync, models.RefundStatusPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.outcome, func(t *testing.T) {
+			p, _ := NewFakeProvider(tt.outcome)
+			created := newFakeSession(t, p, false, "")
+			// Refunds need a collected payment whatever the configured outcome.
+			p.intents[created.PaymentIntentID].Status = "succeeded"
+
+			refund, err := p.CreateRefund(RefundRequest{PaymentIntentID: created.PaymentIntentID, Amount: money.New(2500, "cad")})
+			if err != nil {
+				t.Fatalf("CreateRefund: %v", err)
+			}
+			if refund.Status != tt.status {
+				t.Errorf("refund status = %q, want %q", refund.Status, tt.status)
+			}
+		})
+	}
+}
+
+func TestFakeProviderIDsDifferAcrossProviders(t *testing.T) {
+	// Each process start creates a new provider, while its payments stay stored.
+	first, _ := NewFakeProvider(FakeOutcomeSuccess)
+	second, _ := NewFakeProvider(FakeOutcomeSuccess)
+
+	a, b := newFakeSession(t, first, false, ""), newFakeSession(t, second, false, "")
+	if a.ID == b.ID || a.PaymentIntentID == b.PaymentIntentID {
+		t.Errorf("both providers created session %s with PaymentIntent %s", a.ID, a.PaymentIntentID)
+	}
+}
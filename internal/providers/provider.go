@@ -0,0 +1,125 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+)
+
+// Names of the providers that can be selected with PAYMENT_PROVIDER.
+const (
+	ProviderStripe = "stripe"
+	ProviderFake   = "fake"
+)
+
+// ErrNotFound is returned when the provider has no record of the requested object.
+var ErrNotFound = errors.New("not found at payment provider")
+
+// PaymentProvider is the payment processor the service charges and refunds
+// through. Statuses are reported using Stripe's vocabulary, which the models
+// mirror.
+type PaymentProvider interface {
+	CreateCheckoutSession(req CheckoutSessionRequest) (*CheckoutSession, error)
+	GetCheckoutSession(sessionID string) (*CheckoutSession, error)
+	ExpireCheckoutSession(sessionID string) (*CheckoutSession, error)
+	GetPaymentIntent(paymentIntentID string) (*PaymentIntent, error)
+	CapturePaymentIntent(paymentIntentID string, idempotencyKey string) (*PaymentIntent, error)
+	CancelPaymentIntent(paymentIntentID string, idempotencyKey string) (*PaymentIntent, error)
+	CreateRefund(req RefundRequest) (*Refund, error)
+	GetRefund(refundID string) (*Refund, error)
+	UpdateDisputeEvidence(req DisputeEvidenceRequest) (*Dispute, error)
+}
+
+type LineItem struct {
+	Name       string
+	UnitAmount money.Money
+	Quantity   int64
+}
+
+type CheckoutSessionRequest struct {
+	OrderID        string
+	Currency       string
+	LineItems      []LineItem
+	SuccessURL     string
+	Metadata       map[string]string
+	IdempotencyKey string
+	// ManualCapture only authorizes the payment at checkout, leaving it to be
+	// captured or canceled later.
+	ManualCapture bool
+}
+
+type CheckoutSession struct {
+	ID              string
+	URL             string
+	Status          string
+	PaymentIntentID string
+	Amount          money.Money
+	ExpiresAt       time.Time
+}
+
+type PaymentIntent struct {
+	ID                 string
+	Status             string
+	AmountReceived     money.Money
+	AmountCapturable   money.Money
+	CancellationReason string
+	// CaptureBefore is when an uncaptured authorization is released, or zero if
+	// the provider did not report it.
+	CaptureBefore time.Time
+	Metadata      map[string]string
+}
+
+type RefundRequest struct {
+	PaymentIntentID string
+	Amount          money.Money
+	Reason          string
+	Metadata        map[string]string
+	IdempotencyKey  string
+}
+
+type Refund struct {
+	ID              string
+	PaymentIntentID string
+	Status          string
+	FailureReason   string
+	Amount          money.Money
+	Metadata        map[string]string
+}
+
+// DisputeEvidenceRequest sets evidence fields on a dispute, keyed by Stripe's
+// evidence field names. Evidence that is not submitted is staged on the dispute.
+type DisputeEvidenceRequest struct {
+	DisputeID      string
+	Evidence       map[string]string
+	Submit         bool
+	IdempotencyKey string
+}
+
+type Dispute struct {
+	ID     string
+	Status string
+}
+
+// New returns the provider selected in the configuration.
+func New(cfg *config.Config) (PaymentProvider, error) {
+	switch cfg.PaymentProvider {
+	case ProviderStripe:
+		return NewStripeProvider(NewStripeClient(cfg)), nil
+	case ProviderFake:
+		fake, err := NewFakeProvider(cfg.FakeProviderOutcome)
+		if err != nil {
+			return nil, err
+		}
+		return fake, nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", cfg.PaymentProvider)
+	}
+}
+
+// IsNotFound reports whether err means the provider has no such object.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
@@ -0,0 +1,239 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/client"
+)
+
+type stripeProvider struct {
+	client *client.API
+}
+
+func NewStripeProvider(stripeClient *client.API) PaymentProvider {
+	return &stripeProvider{
+		client: stripeClient,
+	}
+}
+
+func (p *stripeProvider) CreateCheckoutSession(req CheckoutSessionRequest) (*CheckoutSession, error) {
+	lineItems := make([]*stripe.CheckoutSessionLineItemParams, 0, len(req.LineItems))
+	for _, item := range req.LineItems {
+		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency: stripe.String(item.UnitAmount.Currency),
+				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+					Name: stripe.String(item.Name),
+				},
+				UnitAmount: stripe.Int64(item.UnitAmount.Minor),
+			},
+			Quantity: stripe.Int64(item.Quantity),
+		})
+	}
+
+	params := &stripe.CheckoutSessionParams{
+		SuccessURL:        stripe.String(req.SuccessURL),
+		LineItems:         lineItems,
+		ClientReferenceID: stripe.String(req.OrderID),
+		Mode:              stripe.String(string(stripe.CheckoutSessionModePayment)),
+	}
+
+	if req.ManualCapture {
+		params.PaymentIntentData = &stripe.CheckoutSessionPaymentIntentDataParams{
+			CaptureMethod: stripe.String(string(stripe.PaymentIntentCaptureMethodManual)),
+			Metadata:      req.Metadata,
+		}
+	}
+
+	for key, value := range req.Metadata {
+		params.AddMetadata(key, value)
+	}
+	if req.IdempotencyKey != "" {
+		params.SetIdempotencyKey(req.IdempotencyKey)
+	}
+
+	session, err := p.client.CheckoutSessions.New(params)
+	if err != nil {
+		return nil, stripeError(err)
+	}
+	return checkoutSessionFromStripe(session), nil
+}
+
+func (p *stripeProvider) GetCheckoutSession(sessionID string) (*CheckoutSession, error) {
+	session, err := p.client.CheckoutSessions.Get(sessionID, &stripe.CheckoutSessionParams{})
+	if err != nil {
+		return nil, stripeError(err)
+	}
+	return checkoutSessionFromStripe(session), nil
+}
+
+func (p *stripeProvider) ExpireCheckoutSession(sessionID string) (*CheckoutSession, error) {
+	session, err := p.client.CheckoutSessions.Expire(sessionID, &stripe.CheckoutSessionExpireParams{})
+	if err != nil {
+		return nil, stripeError(err)
+	}
+	return checkoutSessionFromStripe(session), nil
+}
+
+// GetPaymentIntent expands the latest charge, which carries the deadline for
+// capturing an authorization.
+func (p *stripeProvider) GetPaymentIntent(paymentIntentID string) (*PaymentIntent, error) {
+	params := &stripe.PaymentIntentParams{}
+	params.AddExpand("latest_charge")
+
+	intent, err := p.client.PaymentIntents.Get(paymentIntentID, params)
+	if err != nil {
+		return nil, stripeError(err)
+	}
+	return paymentIntentFromStripe(intent), nil
+}
+
+func (p *stripeProvider) CapturePaymentIntent(paymentIntentID string, idempotencyKey string) (*PaymentIntent, error) {
+	params := &stripe.PaymentIntentCaptureParams{}
+	params.AddExpand("latest_charge")
+	if idempotencyKey != "" {
+		params.SetIdempotencyKey(idempotencyKey)
+	}
+
+	intent, err := p.client.PaymentIntents.Capture(paymentIntentID, params)
+	if err != nil {
+		return nil, stripeError(err)
+	}
+	return paymentIntentFromStripe(intent), nil
+}
+
+func (p *stripeProvider) CancelPaymentIntent(paymentIntentID string, idempotencyKey string) (*PaymentIntent, error) {
+	params := &stripe.PaymentIntentCancelParams{}
+	params.AddExpand("latest_charge")
+	if idempotencyKey != "" {
+		params.SetIdempotencyKey(idempotencyKey)
+	}
+
+	intent, err := p.client.PaymentIntents.Cancel(paymentIntentID, params)
+	if err != nil {
+		return nil, stripeError(err)
+	}
+	return paymentIntentFromStripe(intent), nil
+}
+
+func (p *stripeProvider) CreateRefund(req RefundRequest) (*Refund, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(req.PaymentIntentID),
+		Amount:        stripe.Int64(req.Amount.Minor),
+		Reason:        stripe.String(stripeRefundReason(req.Reason)),
+	}
+
+	for key, value := range req.Metadata {
+		params.AddMetadata(key, value)
+	}
+	if req.IdempotencyKey != "" {
+		params.SetIdempotencyKey(req.IdempotencyKey)
+	}
+
+	refund, err := p.client.Refunds.New(params)
+	if err != nil {
+		return nil, stripeError(err)
+	}
+	return refundFromStripe(refund), nil
+}
+
+func (p *stripeProvider) GetRefund(refundID string) (*Refund, error) {
+	refund, err := p.client.Refunds.Get(refundID, &stripe.RefundParams{})
+	if err != nil {
+		return nil, stripeError(err)
+	}
+	return refundFromStripe(refund), nil
+}
+
+func (p *stripeProvider) UpdateDisputeEvidence(req DisputeEvidenceRequest) (*Dispute, error) {
+	params := &stripe.DisputeParams{
+		Submit: stripe.Bool(req.Submit),
+	}
+
+	for field, value := range req.Evidence {
+		params.AddExtra(fmt.Sprintf("evidence[%s]", field), value)
+	}
+	if req.IdempotencyKey != "" {
+		params.SetIdempotencyKey(req.IdempotencyKey)
+	}
+
+	dispute, err := p.client.Disputes.Update(req.DisputeID, params)
+	if err != nil {
+		return nil, stripeError(err)
+	}
+
+	return &Dispute{
+		ID:     dispute.ID,
+		Status: string(dispute.Status),
+	}, nil
+}
+
+func checkoutSessionFromStripe(session *stripe.CheckoutSession) *CheckoutSession {
+	converted := &CheckoutSession{
+		ID:        session.ID,
+		URL:       session.URL,
+		Status:    string(session.Status),
+		Amount:    money.New(session.AmountTotal, string(session.Currency)),
+		ExpiresAt: time.Unix(session.ExpiresAt, 0),
+	}
+	if session.PaymentIntent != nil {
+		converted.PaymentIntentID = session.PaymentIntent.ID
+	}
+	return converted
+}
+
+func paymentIntentFromStripe(intent *stripe.PaymentIntent) *PaymentIntent {
+	converted := &PaymentIntent{
+		ID:                 intent.ID,
+		Status:             string(intent.Status),
+		AmountReceived:     money.New(intent.AmountReceived, string(intent.Currency)),
+		AmountCapturable:   money.New(intent.AmountCapturable, string(intent.Currency)),
+		CancellationReason: string(intent.CancellationReason),
+		Metadata:           intent.Metadata,
+	}
+	charge := intent.LatestCharge
+	if charge != nil && charge.PaymentMethodDetails != nil && charge.PaymentMethodDetails.Card != nil && charge.PaymentMethodDetails.Card.CaptureBefore > 0 {
+		converted.CaptureBefore = time.Unix(charge.PaymentMethodDetails.Card.CaptureBefore, 0)
+	}
+	return converted
+}
+
+// stripeError wraps Stripe's missing resource errors in ErrNotFound.
+func stripeError(err error) error {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodeResourceMissing {
+		return fmt.Errorf("%w: %s", ErrNotFound, stripeErr.Msg)
+	}
+	return err
+}
+
+func refundFromStripe(refund *stripe.Refund) *Refund {
+	converted := &Refund{
+		ID:            refund.ID,
+		Status:        string(refund.Status),
+		FailureReason: string(refund.FailureReason),
+		Amount:        money.New(refund.Amount, string(refund.Currency)),
+		Metadata:      refund.Metadata,
+	}
+	if refund.PaymentIntent != nil {
+		converted.PaymentIntentID = refund.PaymentIntent.ID
+	}
+	return converted
+}
+
+// stripeRefundReason maps our refund reason codes onto the reasons Stripe accepts.
+func stripeRefundReason(reason string) string {
+	switch reason {
+	case models.RefundReasonDuplicate:
+		return string(stripe.RefundReasonDuplicate)
+	case models.RefundReasonFraudulent:
+		return string(stripe.RefundReasonFraudulent)
+	default:
+		return string(stripe.RefundReasonRequestedByCustomer)
+	}
+}
@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"net/http"
+
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/client"
+)
+
+// NewStripeClient builds a Stripe client for the configured account. Each client
+// carries its own key and backends, so nothing depends on the package-level
+// stripe.Key and several accounts can be used side by side.
+func NewStripeClient(cfg *config.Config) *client.API {
+	httpClient := &http.Client{
+		Timeout: cfg.StripeHTTPTimeout,
+	}
+	if cfg.StripeAPIVersion != "" {
+		httpClient.Transport = &stripeVersionTransport{
+			version: cfg.StripeAPIVersion,
+			next:    http.DefaultTransport,
+		}
+	}
+
+	backendConfig := func(url string) *stripe.BackendConfig {
+		return &stripe.BackendConfig{
+			HTTPClient:        httpClient,
+			MaxNetworkRetries: stripe.Int64(cfg.StripeMaxNetworkRetries),
+			URL:               stripe.String(url),
+		}
+	}
+
+	apiURL := stripe.APIURL
+	connectURL := stripe.ConnectURL
+	uploadsURL := stripe.UploadsURL
+	if cfg.StripeAPIURL != "" {
+		// A stub stands in for every Stripe host.
+		apiURL, connectURL, uploadsURL = cfg.StripeAPIURL, cfg.StripeAPIURL, cfg.StripeAPIURL
+	}
+
+	return client.New(cfg.StripeSecretKey, &stripe.Backends{
+		API:     stripe.GetBackendWithConfig(stripe.APIBackend, backendConfig(apiURL)),
+		Connect: stripe.GetBackendWithConfig(stripe.ConnectBackend, backendConfig(connectURL)),
+		Uploads: stripe.GetBackendWithConfig(stripe.UploadsBackend, backendConfig(uploadsURL)),
+	})
+}
+
+// stripeVersionTransport pins requests to an API version other than the one the
+// SDK was generated for.
+type stripeVersionTransport struct {
+	version string
+	next    http.RoundTripper
+}
+
+func (t *stripeVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Stripe-Version", t.version)
+	return t.next.RoundTrip(req)
+}
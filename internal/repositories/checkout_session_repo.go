@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type CheckoutSessionRepository interface {
+	CreateSession(session *models.CheckoutSession) error
+	GetOpenSessionByOrderID(orderID string) (*models.CheckoutSession, error)
+	UpdateSessionStatus(stripeSessionID string, status string) error
+}
+
+type checkoutSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewCheckoutSessionRepository(db *gorm.DB) CheckoutSessionRepository {
+	return &checkoutSessionRepository{db}
+}
+
+// CreateSession stores a new open session. It returns a ConflictError if the
+// order already has an open session.
+func (r *checkoutSessionRepository) CreateSession(session *models.CheckoutSession) error {
+	if err := r.db.Create(session).Error; err != nil {
+		if err == gorm.ErrDuplicatedKey {
+			return errors.NewConflictError(fmt.Sprintf("Order '%s' already has an open checkout session", session.OrderID))
+		}
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+func (r *checkoutSessionRepository) GetOpenSessionByOrderID(orderID string) (*models.CheckoutSession, error) {
+	var session models.CheckoutSession
+	err := r.db.Where("order_id = ? AND status = ?", orderID, models.CheckoutSessionStatusOpen).First(&session).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("No open checkout session for order '%s'", orderID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	return &session, nil
+}
+
+func (r *checkoutSessionRepository) UpdateSessionStatus(stripeSessionID string, status string) error {
+	result := r.db.Model(&models.CheckoutSession{}).Where("stripe_session_id = ?", stripeSessionID).Updates(map[string]interface{}{
+		"status":     status,
+		"updated_at": time.Now(),
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Checkout session '%s' not found", stripeSessionID))
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type DisputeRepository interface {
+	CreateDispute(dispute *models.Dispute) error
+	GetDispute(disputeID string) (*models.Dispute, error)
+	GetDisputeByStripeID(stripeDisputeID string) (*models.Dispute, error)
+	UpdateDispute(dispute *models.Dispute) error
+	RecordEvidence(disputeID string, evidence map[string]string, status string, submittedAt *time.Time) error
+	CountOpenDisputes(paymentID string) (int64, error)
+	ListDisputesByStatus(statuses []string, page int32, limit int32) ([]models.Dispute, int64, error)
+}
+
+type disputeRepository struct {
+	db *gorm.DB
+}
+
+func NewDisputeRepository(db *gorm.DB) DisputeRepository {
+	return &disputeRepository{db}
+}
+
+func (r *disputeRepository) CreateDispute(dispute *models.Dispute) error {
+	if err := r.db.Create(dispute).Error; err != nil {
+		if err == gorm.ErrDuplicatedKey {
+			return errors.NewConflictError(fmt.Sprintf("Dispute '%s' is already stored", dispute.StripeDisputeID))
+		}
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+func (r *disputeRepository) GetDispute(disputeID string) (*models.Dispute, error) {
+	var dispute models.Dispute
+	err := r.db.Where("id = ?", disputeID).First(&dispute).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Dispute with ID '%s' not found", disputeID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	return &dispute, nil
+}
+
+func (r *disputeRepository) GetDisputeByStripeID(stripeDisputeID string) (*models.Dispute, error) {
+	var dispute models.Dispute
+	err := r.db.Where("stripe_dispute_id = ?", stripeDisputeID).First(&dispute).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Dispute with Stripe ID '%s' not found", stripeDisputeID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	return &dispute, nil
+}
+
+// UpdateDispute records the details Stripe reports for a dispute.
+func (r *disputeRepository) UpdateDispute(dispute *models.Dispute) error {
+	result := r.db.Model(dispute).Select("amount_minor", "amount_currency", "reason", "status", "evidence_due_by", "updated_at").Updates(dispute)
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Dispute with ID '%s' not found", dispute.ID))
+	}
+
+	return nil
+}
+
+// RecordEvidence stores the evidence sent to Stripe for a dispute and the status
+// Stripe reported back. submittedAt is set once the evidence is submitted.
+func (r *disputeRepository) RecordEvidence(disputeID string, evidence map[string]string, status string, submittedAt *time.Time) error {
+	result := r.db.Model(&models.Dispute{}).Where("id = ?", disputeID).Updates(&models.Dispute{
+		Evidence:            evidence,
+		Status:              status,
+		EvidenceSubmittedAt: submittedAt,
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Dispute with ID '%s' not found", disputeID))
+	}
+
+	return nil
+}
+
+func (r *disputeRepository) CountOpenDisputes(paymentID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Dispute{}).Where("payment_id = ? AND status IN ?", paymentID, models.OpenDisputeStatuses).Count(&count).Error
+	if err != nil {
+		return 0, errors.NewInternalError(err)
+	}
+	return count, nil
+}
+
+// ListDisputesByStatus returns a page of disputes in any of the statuses, those
+// whose evidence is due first coming first.
+func (r *disputeRepository) ListDisputesByStatus(statuses []string, page int32, limit int32) ([]models.Dispute, int64, error) {
+	var disputes []models.Dispute
+	var total int64
+
+	query := r.db.Model(&models.Dispute{}).Where("status IN ?", statuses)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.NewInternalError(err)
+	}
+
+	err := query.Order("evidence_due_by ASC NULLS LAST").Order("created_at ASC").Offset(int((page - 1) * limit)).Limit(int(limit)).Find(&disputes).Error
+	if err != nil {
+		return nil, 0, errors.NewInternalError(err)
+	}
+
+	return disputes, total, nil
+}
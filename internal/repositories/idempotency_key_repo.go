@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyKeyRepository interface {
+	ReserveKey(key *models.IdempotencyKey, staleBefore time.Time) (*models.IdempotencyKey, bool, error)
+	CompleteKey(method string, key string, response []byte) error
+	ReleaseKey(method string, key string) error
+}
+
+type idempotencyKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyKeyRepository(db *gorm.DB) IdempotencyKeyRepository {
+	return &idempotencyKeyRepository{db}
+}
+
+// ReserveKey inserts the key as in progress and reports whether the caller now
+// holds it. A key left in progress since before staleBefore with the same request
+// hash is assumed abandoned and handed to the caller. Otherwise the existing key
+// is returned so the caller can replay its response or reject the request.
+func (r *idempotencyKeyRepository) ReserveKey(key *models.IdempotencyKey, staleBefore time.Time) (*models.IdempotencyKey, bool, error) {
+	key.Status = models.IdempotencyKeyStatusInProgress
+
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+	if result.Error != nil {
+		return nil, false, errors.NewInternalError(result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return key, true, nil
+	}
+
+	result = r.db.Model(&models.IdempotencyKey{}).
+		Where("key = ? AND method = ? AND request_hash = ? AND status = ? AND updated_at < ?",
+			key.Key, key.Method, key.RequestHash, models.IdempotencyKeyStatusInProgress, staleBefore).
+		Update("updated_at", time.Now())
+	if result.Error != nil {
+		return nil, false, errors.NewInternalError(result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return key, true, nil
+	}
+
+	var existing models.IdempotencyKey
+	err := r.db.Where("key = ? AND method = ?", key.Key, key.Method).First(&existing).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			// The holder released the key between our insert and this read.
+			return nil, false, errors.NewConflictError(fmt.Sprintf("Idempotency key '%s' is being retried, try again", key.Key))
+		}
+		return nil, false, errors.NewInternalError(err)
+	}
+	return &existing, false, nil
+}
+
+func (r *idempotencyKeyRepository) CompleteKey(method string, key string, response []byte) error {
+	result := r.db.Model(&models.IdempotencyKey{}).Where("key = ? AND method = ?", key, method).Updates(map[string]interface{}{
+		"status":     models.IdempotencyKeyStatusCompleted,
+		"response":   response,
+		"updated_at": time.Now(),
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Idempotency key '%s' not found", key))
+	}
+
+	return nil
+}
+
+// ReleaseKey removes a key that is still in progress so the request can be retried.
+func (r *idempotencyKeyRepository) ReleaseKey(method string, key string) error {
+	err := r.db.Where("key = ? AND method = ? AND status = ?", key, method, models.IdempotencyKeyStatusInProgress).
+		Delete(&models.IdempotencyKey{}).Error
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
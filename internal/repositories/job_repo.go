@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type JobRepository interface {
+	AcquireLease(job string, holder string, until time.Time) (bool, error)
+	StartRun(run *models.JobRun) error
+	FinishRun(runID string, status string, runErr string) error
+	DeleteRunsBefore(before time.Time) (int64, error)
+}
+
+type jobRepository struct {
+	db *gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) JobRepository {
+	return &jobRepository{db}
+}
+
+// AcquireLease takes or renews the lease of a job until the given time. It
+// succeeds if the lease is free, expired or already held by the holder, and
+// reports false if another holder has it.
+func (r *jobRepository) AcquireLease(job string, holder string, until time.Time) (bool, error) {
+	result := r.db.Exec(`
+		INSERT INTO job_leases (name, holder, expires_at, updated_at)
+		VALUES (?, ?, ?, now())
+		ON CONFLICT (name) DO UPDATE
+		SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at, updated_at = now()
+		WHERE job_leases.holder = EXCLUDED.holder OR job_leases.expires_at < now()`,
+		job, holder, until,
+	)
+	if result.Error != nil {
+		return false, errors.NewInternalError(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *jobRepository) StartRun(run *models.JobRun) error {
+	if err := r.db.Create(run).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+// FinishRun records the outcome of a run.
+func (r *jobRepository) FinishRun(runID string, status string, runErr string) error {
+	result := r.db.Model(&models.JobRun{}).Where("id = ?", runID).Updates(map[string]interface{}{
+		"status":      status,
+		"error":       runErr,
+		"finished_at": time.Now(),
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Job run '%s' not found", runID))
+	}
+
+	return nil
+}
+
+// DeleteRunsBefore removes the records of runs started before the given time and
+// returns how many were removed.
+func (r *jobRepository) DeleteRunsBefore(before time.Time) (int64, error) {
+	result := r.db.Where("started_at < ?", before).Delete(&models.JobRun{})
+	if result.Error != nil {
+		return 0, errors.NewInternalError(result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type OutboxRepository interface {
+	ClaimDueMessages(leaseUntil time.Time, limit int) ([]models.OutboxMessage, error)
+	MarkMessageDelivered(messageID string) error
+	MarkMessageFailed(messageID string, lastError string, nextAttemptAt time.Time) error
+	MarkMessageDeadLettered(messageID string, lastError string) error
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &outboxRepository{db}
+}
+
+// ClaimDueMessages leases pending messages that are due for delivery until
+// leaseUntil and bumps their attempt counter. A message is only claimed once every
+// older message for the same aggregate has been delivered, so an order never sees
+// its updates out of order. Rows locked by another dispatcher are skipped.
+func (r *outboxRepository) ClaimDueMessages(leaseUntil time.Time, limit int) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+
+	err := r.db.Raw(`
+		UPDATE outbox_messages
+		SET attempts = attempts + 1, next_attempt_at = ?
+		WHERE id IN (
+			SELECT m.id FROM outbox_messages m
+			WHERE m.status = ? AND m.next_attempt_at <= ?
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox_messages older
+				WHERE older.aggregate_id = m.aggregate_id
+				AND older.status = ?
+				AND older.created_at < m.created_at
+			)
+			ORDER BY m.created_at ASC
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		leaseUntil, models.OutboxStatusPending, time.Now(), models.OutboxStatusPending, limit,
+	).Scan(&messages).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+
+	return messages, nil
+}
+
+func (r *outboxRepository) MarkMessageDelivered(messageID string) error {
+	result := r.db.Model(&models.OutboxMessage{}).Where("id = ?", messageID).Updates(map[string]interface{}{
+		"status":       models.OutboxStatusDelivered,
+		"last_error":   "",
+		"delivered_at": time.Now(),
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Outbox message '%s' not found", messageID))
+	}
+
+	return nil
+}
+
+// MarkMessageFailed records a failed delivery and schedules the next attempt.
+func (r *outboxRepository) MarkMessageFailed(messageID string, lastError string, nextAttemptAt time.Time) error {
+	result := r.db.Model(&models.OutboxMessage{}).Where("id = ?", messageID).Updates(map[string]interface{}{
+		"last_error":      lastError,
+		"next_attempt_at": nextAttemptAt,
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Outbox message '%s' not found", messageID))
+	}
+
+	return nil
+}
+
+// MarkMessageDeadLettered gives up on delivering the message, letting later
+// messages for the same aggregate through.
+func (r *outboxRepository) MarkMessageDeadLettered(messageID string, lastError string) error {
+	result := r.db.Model(&models.OutboxMessage{}).Where("id = ?", messageID).Updates(map[string]interface{}{
+		"status":     models.OutboxStatusDeadLetter,
+		"last_error": lastError,
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Outbox message '%s' not found", messageID))
+	}
+
+	return nil
+}
@@ -1,19 +1,33 @@
 package repositories
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/PharmaKart/payment-svc/internal/models"
 	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaymentRepository interface {
-	StorePayment(payment *models.Payment) error
+	StorePayment(payment *models.Payment, change models.PaymentStatusChange) error
 	GetPaymentByOrderID(orderID string) (*models.Payment, error)
+	ListPaymentsByOrderID(orderID string) ([]models.Payment, error)
 	GetPaymentByTransactionID(transactionID string) (*models.Payment, error)
+	GetPaymentByCheckoutSessionID(checkoutSessionID string) (*models.Payment, error)
+	UpdateTransactionID(paymentID string, transactionID string) error
 	GetPayment(paymentID string) (*models.Payment, error)
-	UpdatePaymentStatus(orderID string, status string) error
+	UpdatePaymentStatus(paymentID string, status string, change models.PaymentStatusChange) error
+	AuthorizePayment(paymentID string, status string, expiresAt time.Time, change models.PaymentStatusChange) error
+	RecordCapture(paymentID string, status string, change models.PaymentStatusChange) error
+	ListExpiringAuthorizations(before time.Time, limit int) ([]models.Payment, error)
+	MarkAuthorizationAlerted(paymentID string, alertedAt time.Time) error
+	ListStalePendingPayments(afterCreatedAt time.Time, afterID uuid.UUID, createdBefore time.Time, limit int) ([]models.Payment, error)
+	RecordPaymentChange(paymentID string, change models.PaymentStatusChange) error
+	GetPaymentTimeline(orderID string) ([]models.PaymentStatusChange, error)
 }
 
 type paymentRepository struct {
@@ -24,16 +38,29 @@ func NewPaymentRepository(db *gorm.DB) PaymentRepository {
 	return &paymentRepository{db}
 }
 
-func (r *paymentRepository) StorePayment(payment *models.Payment) error {
-	if err := r.db.Create(payment).Error; err != nil {
-		return errors.NewInternalError(err)
-	}
-	return nil
+// StorePayment creates the payment and the first entry of its history together.
+func (r *paymentRepository) StorePayment(payment *models.Payment, change models.PaymentStatusChange) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payment).Error; err != nil {
+			if err == gorm.ErrDuplicatedKey {
+				return errors.NewConflictError(fmt.Sprintf("Order '%s' already has a successful payment or transaction '%s' is already stored", payment.OrderID, payment.TransactionID))
+			}
+			return errors.NewInternalError(err)
+		}
+
+		change.ToStatus = payment.Status
+		return recordChange(tx, payment, change)
+	})
 }
 
+// GetPaymentByOrderID returns the effective payment for an order: its successful
+// payment if there is one, otherwise its most recent attempt.
 func (r *paymentRepository) GetPaymentByOrderID(orderID string) (*models.Payment, error) {
 	var payment models.Payment
-	err := r.db.Where("order_id = ?", orderID).First(&payment).Error
+	err := r.db.Where("order_id = ? AND status IN ?", orderID, models.SuccessfulPaymentStatuses).First(&payment).Error
+	if err == gorm.ErrRecordNotFound {
+		err = r.db.Where("order_id = ?", orderID).Order("created_at DESC").First(&payment).Error
+	}
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, errors.NewNotFoundError(fmt.Sprintf("Payment for order ID '%s' not found", orderID))
@@ -43,6 +70,15 @@ func (r *paymentRepository) GetPaymentByOrderID(orderID string) (*models.Payment
 	return &payment, nil
 }
 
+func (r *paymentRepository) ListPaymentsByOrderID(orderID string) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := r.db.Where("order_id = ?", orderID).Order("created_at ASC").Find(&payments).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	return payments, nil
+}
+
 func (r *paymentRepository) GetPaymentByTransactionID(transactionID string) (*models.Payment, error) {
 	var payment models.Payment
 	err := r.db.Where("transaction_id = ?", transactionID).First(&payment).Error
@@ -55,6 +91,37 @@ func (r *paymentRepository) GetPaymentByTransactionID(transactionID string) (*mo
 	return &payment, nil
 }
 
+func (r *paymentRepository) GetPaymentByCheckoutSessionID(checkoutSessionID string) (*models.Payment, error) {
+	var payment models.Payment
+	err := r.db.Where("checkout_session_id = ?", checkoutSessionID).First(&payment).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Payment for checkout session '%s' not found", checkoutSessionID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	return &payment, nil
+}
+
+// UpdateTransactionID replaces the checkout session ID a pending payment was
+// created with by the PaymentIntent ID it was eventually paid with.
+func (r *paymentRepository) UpdateTransactionID(paymentID string, transactionID string) error {
+	result := r.db.Model(&models.Payment{}).Where("id = ?", paymentID).Update("transaction_id", transactionID)
+
+	if result.Error != nil {
+		if result.Error == gorm.ErrDuplicatedKey {
+			return errors.NewConflictError(fmt.Sprintf("Transaction '%s' is already stored", transactionID))
+		}
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Payment with ID '%s' not found", paymentID))
+	}
+
+	return nil
+}
+
 func (r *paymentRepository) GetPayment(paymentID string) (*models.Payment, error) {
 	var payment models.Payment
 	err := r.db.Where("id = ?", paymentID).First(&payment).Error
@@ -67,16 +134,176 @@ func (r *paymentRepository) GetPayment(paymentID string) (*models.Payment, error
 	return &payment, nil
 }
 
-func (r *paymentRepository) UpdatePaymentStatus(orderID string, status string) error {
-	result := r.db.Model(&models.Payment{}).Where("order_id = ?", orderID).Update("status", status)
+// UpdatePaymentStatus moves a payment to a new status, enforcing the payment
+// state machine, and records the change in its history. The row is locked while
+// the transition is checked so concurrent updates cannot both succeed from the
+// same starting status. Setting the current status again is a no-op.
+func (r *paymentRepository) UpdatePaymentStatus(paymentID string, status string, change models.PaymentStatusChange) error {
+	return r.transition(paymentID, status, map[string]interface{}{}, change)
+}
+
+// AuthorizePayment records the authorization of a pending manual capture payment
+// and when the provider will release it, moving the payment to status: authorized,
+// or manual_review if the authorization is held.
+func (r *paymentRepository) AuthorizePayment(paymentID string, status string, expiresAt time.Time, change models.PaymentStatusChange) error {
+	return r.transition(paymentID, status, map[string]interface{}{
+		"authorization_expires_at": expiresAt,
+	}, change)
+}
+
+// RecordCapture moves a captured authorization to status: successful, or
+// manual_review if the capture is held. The authorization expiry is cleared, as
+// there is nothing left to expire.
+func (r *paymentRepository) RecordCapture(paymentID string, status string, change models.PaymentStatusChange) error {
+	return r.transition(paymentID, status, map[string]interface{}{
+		"authorization_expires_at": nil,
+	}, change)
+}
+
+// ListExpiringAuthorizations returns uncaptured authorizations, including those
+// held for review, that expire before the given time and have not been alerted on
+// yet, soonest first.
+func (r *paymentRepository) ListExpiringAuthorizations(before time.Time, limit int) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := r.db.
+		Where("status IN ? AND authorization_expires_at < ? AND authorization_alerted_at IS NULL", []string{models.PaymentStatusAuthorized, models.PaymentStatusManualReview}, before).
+		Order("authorization_expires_at ASC").
+		Limit(limit).
+		Find(&payments).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	return payments, nil
+}
+
+// ListStalePendingPayments returns pending payments created before createdBefore,
+// oldest first. Callers page through them by passing the creation time and ID of
+// the last payment returned, so payments created at the same instant are
+// neither skipped nor returned twice.
+func (r *paymentRepository) ListStalePendingPayments(afterCreatedAt time.Time, afterID uuid.UUID, createdBefore time.Time, limit int) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := r.db.
+		Where("status = ? AND (created_at, id) > (?, ?) AND created_at < ?", models.PaymentStatusPending, afterCreatedAt, afterID, createdBefore).
+		Order("created_at ASC, id ASC").
+		Limit(limit).
+		Find(&payments).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	return payments, nil
+}
+
+func (r *paymentRepository) MarkAuthorizationAlerted(paymentID string, alertedAt time.Time) error {
+	result := r.db.Model(&models.Payment{}).Where("id = ?", paymentID).Update("authorization_alerted_at", alertedAt)
 
 	if result.Error != nil {
 		return errors.NewInternalError(result.Error)
 	}
 
 	if result.RowsAffected == 0 {
-		return errors.NewNotFoundError(fmt.Sprintf("Payment for order ID '%s' not found", orderID))
+		return errors.NewNotFoundError(fmt.Sprintf("Payment with ID '%s' not found", paymentID))
 	}
 
 	return nil
 }
+
+// transition moves a payment to a new status together with the given columns,
+// as described on UpdatePaymentStatus.
+func (r *paymentRepository) transition(paymentID string, status string, updates map[string]interface{}, change models.PaymentStatusChange) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", paymentID).First(&payment).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewNotFoundError(fmt.Sprintf("Payment with ID '%s' not found", paymentID))
+			}
+			return errors.NewInternalError(err)
+		}
+
+		if payment.Status == status {
+			return nil
+		}
+
+		if !models.CanTransitionPayment(payment.Status, status) {
+			return errors.NewConflictError(fmt.Sprintf("Payment with ID '%s' cannot move from %s to %s", paymentID, payment.Status, status))
+		}
+
+		updates["status"] = status
+		if err := tx.Model(&payment).Updates(updates).Error; err != nil {
+			if err == gorm.ErrDuplicatedKey {
+				return errors.NewConflictError(fmt.Sprintf("Order '%s' already has a successful payment", payment.OrderID))
+			}
+			return errors.NewInternalError(err)
+		}
+
+		change.FromStatus = payment.Status
+		change.ToStatus = status
+		return recordChange(tx, &payment, change)
+	})
+}
+
+// RecordPaymentChange adds a history entry for a change that did not move the
+// payment to a new status, such as a refund being requested.
+func (r *paymentRepository) RecordPaymentChange(paymentID string, change models.PaymentStatusChange) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		err := tx.Where("id = ?", paymentID).First(&payment).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewNotFoundError(fmt.Sprintf("Payment with ID '%s' not found", paymentID))
+			}
+			return errors.NewInternalError(err)
+		}
+
+		change.FromStatus = payment.Status
+		change.ToStatus = payment.Status
+		return recordChange(tx, &payment, change)
+	})
+}
+
+// GetPaymentTimeline returns the history of every payment attempt for an order,
+// oldest first.
+func (r *paymentRepository) GetPaymentTimeline(orderID string) ([]models.PaymentStatusChange, error) {
+	var changes []models.PaymentStatusChange
+	err := r.db.
+		Joins("JOIN payments ON payments.id = payment_status_changes.payment_id").
+		Where("payments.order_id = ?", orderID).
+		Order("payment_status_changes.created_at ASC").
+		Find(&changes).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	return changes, nil
+}
+
+// recordChange writes a history entry for the payment and, if the change carries
+// an order status, queues the order service notification in the same transaction.
+func recordChange(tx *gorm.DB, payment *models.Payment, change models.PaymentStatusChange) error {
+	change.PaymentID = payment.ID
+	if err := tx.Create(&change).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	if change.OrderStatus == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(models.OrderStatusUpdate{
+		OrderID: payment.OrderID.String(),
+		Status:  change.OrderStatus,
+	})
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	message := &models.OutboxMessage{
+		Topic:       models.OutboxTopicOrderStatus,
+		AggregateID: payment.OrderID.String(),
+		Payload:     payload,
+		Status:      models.OutboxStatusPending,
+	}
+	if err := tx.Create(message).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RefundApprovalRepository interface {
+	CreateApproval(approval *models.RefundApproval) error
+	GetApproval(approvalID string) (*models.RefundApproval, error)
+	ListPendingApprovals(paymentID string) ([]models.RefundApproval, error)
+	DecideApproval(approvalID string, status string, decidedBy string, comment string) error
+	ReserveRefund(approvalID string, refund *models.Refund) (*models.Refund, bool, error)
+}
+
+type refundApprovalRepository struct {
+	db *gorm.DB
+}
+
+func NewRefundApprovalRepository(db *gorm.DB) RefundApprovalRepository {
+	return &refundApprovalRepository{db}
+}
+
+func (r *refundApprovalRepository) CreateApproval(approval *models.RefundApproval) error {
+	if err := r.db.Create(approval).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+func (r *refundApprovalRepository) GetApproval(approvalID string) (*models.RefundApproval, error) {
+	var approval models.RefundApproval
+	err := r.db.Where("id = ?", approvalID).First(&approval).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Refund approval with ID '%s' not found", approvalID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	return &approval, nil
+}
+
+func (r *refundApprovalRepository) ListPendingApprovals(paymentID string) ([]models.RefundApproval, error) {
+	var approvals []models.RefundApproval
+	err := r.db.Where("payment_id = ? AND status = ?", paymentID, models.RefundApprovalStatusPending).Order("created_at").Find(&approvals).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	return approvals, nil
+}
+
+// DecideApproval records the decision on a pending approval. Only one decision
+// is ever recorded: a request that was decided in the meantime is a conflict, as
+// is rejecting a request whose refund is being issued.
+func (r *refundApprovalRepository) DecideApproval(approvalID string, status string, decidedBy string, comment string) error {
+	query := r.db.Model(&models.RefundApproval{}).
+		Where("id = ? AND status = ?", approvalID, models.RefundApprovalStatusPending)
+	if status == models.RefundApprovalStatusRejected {
+		query = query.Where("refund_id IS NULL OR refund_id IN (?)", r.db.Model(&models.Refund{}).Select("id").Where("status IN ?", []string{models.RefundStatusFailed, models.RefundStatusCanceled}))
+	}
+
+	result := query.
+		Updates(map[string]interface{}{
+			"status":     status,
+			"decided_by": decidedBy,
+			"decided_at": time.Now(),
+			"comment":    comment,
+			"updated_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewConflictError(fmt.Sprintf("Refund approval '%s' has already been decided or its refund is being issued", approvalID))
+	}
+
+	return nil
+}
+
+// ReserveRefund reserves the refund of a pending approval, with the approval row
+// locked so it is reserved at most once however many approvers act on it. If the
+// approval's refund was already reserved and has not failed, that refund is
+// returned instead and created is false.
+func (r *refundApprovalRepository) ReserveRefund(approvalID string, refund *models.Refund) (*models.Refund, bool, error) {
+	reserved := refund
+	created := false
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var approval models.RefundApproval
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", approvalID).First(&approval).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.NewNotFoundError(fmt.Sprintf("Refund approval with ID '%s' not found", approvalID))
+			}
+			return errors.NewInternalError(err)
+		}
+		if approval.Status != models.RefundApprovalStatusPending {
+			return errors.NewConflictError(fmt.Sprintf("Refund approval '%s' has already been %s", approvalID, approval.Status))
+		}
+
+		if approval.RefundID != nil {
+			var existing models.Refund
+			if err := tx.Where("id = ?", *approval.RefundID).First(&existing).Error; err != nil {
+				return errors.NewInternalError(err)
+			}
+			if existing.IsOpen() {
+				reserved = &existing
+				return nil
+			}
+		}
+
+		if err := reserveRefund(tx, refund); err != nil {
+			return err
+		}
+		if err := tx.Model(&approval).Updates(map[string]interface{}{
+			"refund_id":  refund.ID,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return errors.NewInternalError(err)
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return reserved, created, nil
+}
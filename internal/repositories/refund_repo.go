@@ -0,0 +1,129 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RefundRepository interface {
+	CreateRefund(refund *models.Refund) error
+	RecordRefund(refund *models.Refund) error
+	GetRefund(refundID string) (*models.Refund, error)
+	GetRefundByStripeID(stripeRefundID string) (*models.Refund, error)
+	UpdateRefund(refund *models.Refund) error
+	ListRefundsByPaymentID(paymentID string) ([]models.Refund, error)
+}
+
+type refundRepository struct {
+	db *gorm.DB
+}
+
+func NewRefundRepository(db *gorm.DB) RefundRepository {
+	return &refundRepository{db}
+}
+
+// CreateRefund reserves a refund against its payment. The payment row is locked
+// while the open refunds are summed, so concurrent requests cannot refund more
+// than the payment amount between them.
+func (r *refundRepository) CreateRefund(refund *models.Refund) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return reserveRefund(tx, refund)
+	})
+}
+
+// reserveRefund creates the refund within tx once it has checked it against the
+// refundable balance of its payment, whose row it locks.
+func reserveRefund(tx *gorm.DB, refund *models.Refund) error {
+	var payment models.Payment
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", refund.PaymentID).First(&payment).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errors.NewNotFoundError(fmt.Sprintf("Payment with ID '%s' not found", refund.PaymentID))
+		}
+		return errors.NewInternalError(err)
+	}
+
+	if !refund.Amount.SameCurrency(payment.Amount) {
+		return errors.NewValidationError("currency", fmt.Sprintf("Refund currency %s does not match payment currency %s", refund.Amount.Currency, payment.Amount.Currency))
+	}
+
+	var refundedMinor int64
+	err = tx.Model(&models.Refund{}).
+		Where("payment_id = ? AND status NOT IN ?", refund.PaymentID, []string{models.RefundStatusFailed, models.RefundStatusCanceled}).
+		Select("COALESCE(SUM(amount_minor), 0)").
+		Scan(&refundedMinor).Error
+	if err != nil {
+		return errors.NewInternalError(err)
+	}
+
+	refundable := money.New(payment.Amount.Minor-refundedMinor, payment.Amount.Currency)
+	if refund.Amount.Minor > refundable.Minor {
+		return errors.NewValidationError("amount", fmt.Sprintf("Refund exceeds the refundable balance of %s", refundable))
+	}
+
+	if err := tx.Create(refund).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+// RecordRefund stores a refund that already happened at Stripe, such as one issued
+// from the dashboard, without checking it against the refundable balance.
+func (r *refundRepository) RecordRefund(refund *models.Refund) error {
+	if err := r.db.Create(refund).Error; err != nil {
+		return errors.NewInternalError(err)
+	}
+	return nil
+}
+
+func (r *refundRepository) GetRefund(refundID string) (*models.Refund, error) {
+	var refund models.Refund
+	err := r.db.Where("id = ?", refundID).First(&refund).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Refund with ID '%s' not found", refundID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	return &refund, nil
+}
+
+func (r *refundRepository) GetRefundByStripeID(stripeRefundID string) (*models.Refund, error) {
+	var refund models.Refund
+	err := r.db.Where("stripe_refund_id = ?", stripeRefundID).First(&refund).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Refund with Stripe ID '%s' not found", stripeRefundID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	return &refund, nil
+}
+
+func (r *refundRepository) UpdateRefund(refund *models.Refund) error {
+	result := r.db.Model(refund).Select("stripe_refund_id", "status", "failure_reason", "updated_at").Updates(refund)
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Refund with ID '%s' not found", refund.ID))
+	}
+
+	return nil
+}
+
+func (r *refundRepository) ListRefundsByPaymentID(paymentID string) ([]models.Refund, error) {
+	var refunds []models.Refund
+	err := r.db.Where("payment_id = ?", paymentID).Order("created_at ASC").Find(&refunds).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+	return refunds, nil
+}
@@ -0,0 +1,175 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookEventRepository interface {
+	StoreEvent(event *models.WebhookEvent) (bool, error)
+	GetEvent(eventID string) (*models.WebhookEvent, error)
+	ClaimEvent(eventID string, staleBefore time.Time) (bool, error)
+	MarkEventProcessed(eventID string) error
+	ScheduleEventRetry(eventID string, lastError string, nextAttemptAt time.Time) error
+	MarkEventFailed(eventID string, lastError string) error
+	ListEventsByStatus(status string, page int32, limit int32) ([]models.WebhookEvent, int64, error)
+	ListRetryableEvents(now time.Time, staleBefore time.Time, limit int) ([]models.WebhookEvent, error)
+}
+
+type webhookEventRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookEventRepository(db *gorm.DB) WebhookEventRepository {
+	return &webhookEventRepository{db}
+}
+
+// StoreEvent inserts the event and reports whether it was new. Events that were
+// already received are left untouched.
+func (r *webhookEventRepository) StoreEvent(event *models.WebhookEvent) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		return false, errors.NewInternalError(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *webhookEventRepository) GetEvent(eventID string) (*models.WebhookEvent, error) {
+	var event models.WebhookEvent
+	err := r.db.Where("id = ?", eventID).First(&event).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Webhook event '%s' not found", eventID))
+		}
+		return nil, errors.NewInternalError(err)
+	}
+	return &event, nil
+}
+
+// ClaimEvent moves the event to processing and bumps its attempt counter. Events
+// stuck in processing since before staleBefore are assumed abandoned and can be
+// claimed again. It returns false if another worker holds the event or it is
+// already processed.
+func (r *webhookEventRepository) ClaimEvent(eventID string, staleBefore time.Time) (bool, error) {
+	result := r.db.Model(&models.WebhookEvent{}).
+		Where("id = ?", eventID).
+		Where("status IN ? OR (status = ? AND updated_at < ?)",
+			[]string{models.WebhookEventStatusPending, models.WebhookEventStatusFailed},
+			models.WebhookEventStatusProcessing, staleBefore).
+		Updates(map[string]interface{}{
+			"status":     models.WebhookEventStatusProcessing,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"updated_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		return false, errors.NewInternalError(result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (r *webhookEventRepository) MarkEventProcessed(eventID string) error {
+	now := time.Now()
+	result := r.db.Model(&models.WebhookEvent{}).Where("id = ?", eventID).Updates(map[string]interface{}{
+		"status":       models.WebhookEventStatusProcessed,
+		"last_error":   "",
+		"processed_at": now,
+		"updated_at":   now,
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Webhook event '%s' not found", eventID))
+	}
+
+	return nil
+}
+
+// ScheduleEventRetry returns a failed attempt's event to pending, due again at
+// nextAttemptAt.
+func (r *webhookEventRepository) ScheduleEventRetry(eventID string, lastError string, nextAttemptAt time.Time) error {
+	result := r.db.Model(&models.WebhookEvent{}).Where("id = ?", eventID).Updates(map[string]interface{}{
+		"status":          models.WebhookEventStatusPending,
+		"last_error":      lastError,
+		"next_attempt_at": nextAttemptAt,
+		"updated_at":      time.Now(),
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Webhook event '%s' not found", eventID))
+	}
+
+	return nil
+}
+
+// MarkEventFailed gives up on the event. It is no longer retried, only replayed.
+func (r *webhookEventRepository) MarkEventFailed(eventID string, lastError string) error {
+	result := r.db.Model(&models.WebhookEvent{}).Where("id = ?", eventID).Updates(map[string]interface{}{
+		"status":          models.WebhookEventStatusFailed,
+		"last_error":      lastError,
+		"next_attempt_at": nil,
+		"updated_at":      time.Now(),
+	})
+
+	if result.Error != nil {
+		return errors.NewInternalError(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.NewNotFoundError(fmt.Sprintf("Webhook event '%s' not found", eventID))
+	}
+
+	return nil
+}
+
+func (r *webhookEventRepository) ListEventsByStatus(status string, page int32, limit int32) ([]models.WebhookEvent, int64, error) {
+	var events []models.WebhookEvent
+	var total int64
+
+	query := r.db.Model(&models.WebhookEvent{}).Where("status = ?", status)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.NewInternalError(err)
+	}
+
+	err := query.Order("created_at ASC").Offset(int((page - 1) * limit)).Limit(int(limit)).Find(&events).Error
+	if err != nil {
+		return nil, 0, errors.NewInternalError(err)
+	}
+
+	return events, total, nil
+}
+
+// ListRetryableEvents returns events that are due for processing: pending events
+// whose next attempt is due by now, and processing events that have been stuck
+// since before staleBefore. Events waiting out their backoff are left out, so
+// they do not crowd out events that are due.
+func (r *webhookEventRepository) ListRetryableEvents(now time.Time, staleBefore time.Time, limit int) ([]models.WebhookEvent, error) {
+	var events []models.WebhookEvent
+
+	err := r.db.
+		Where("(status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)) OR (status = ? AND updated_at < ?)",
+			models.WebhookEventStatusPending, now,
+			models.WebhookEventStatusProcessing, staleBefore).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, errors.NewInternalError(err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+)
+
+const authorizationAlertBatchSize = 100
+
+type AuthorizationMonitor interface {
+	CheckExpiringAuthorizations() error
+}
+
+type authorizationMonitor struct {
+	paymentRepo repositories.PaymentRepository
+	cfg         *config.Config
+}
+
+func NewAuthorizationMonitor(paymentRepo repositories.PaymentRepository, cfg *config.Config) AuthorizationMonitor {
+	return &authorizationMonitor{
+		paymentRepo: paymentRepo,
+		cfg:         cfg,
+	}
+}
+
+// CheckExpiringAuthorizations alerts on uncaptured authorizations that expire
+// within the configured warning period, so their prescriptions can be verified
+// before the customer's funds are released. Each authorization is alerted on once.
+func (m *authorizationMonitor) CheckExpiringAuthorizations() error {
+	payments, err := m.paymentRepo.ListExpiringAuthorizations(time.Now().Add(m.cfg.AuthorizationExpiryWarning), authorizationAlertBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		utils.Error("Payment authorization expires before capture", map[string]interface{}{
+			"alert":          "authorization_expiring",
+			"payment_id":     payment.ID,
+			"order_id":       payment.OrderID,
+			"transaction_id": payment.TransactionID,
+			"status":         payment.Status,
+			"expires_at":     payment.AuthorizationExpiresAt,
+		})
+
+		if err := m.paymentRepo.MarkAuthorizationAlerted(payment.ID.String(), time.Now()); err != nil {
+			utils.Error("Failed to record authorization alert", map[string]interface{}{
+				"payment_id": payment.ID,
+				"error":      err.Error(),
+			})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/providers"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+)
+
+type DisputeService interface {
+	RecordDispute(update *models.Dispute, paymentIntentID string, actor models.Actor) error
+	ListOpenDisputes(page int32, limit int32) ([]models.Dispute, int64, error)
+	UpdateDisputeEvidence(disputeID string, evidence map[string]string, submit bool, actor models.Actor, idempotencyKey string) (*models.Dispute, error)
+}
+
+type disputeService struct {
+	disputeRepo    repositories.DisputeRepository
+	paymentRepo    repositories.PaymentRepository
+	paymentService PaymentService
+	provider       providers.PaymentProvider
+}
+
+func NewDisputeService(disputeRepo repositories.DisputeRepository, paymentRepo repositories.PaymentRepository, paymentService PaymentService, provider providers.PaymentProvider) DisputeService {
+	return &disputeService{
+		disputeRepo:    disputeRepo,
+		paymentRepo:    paymentRepo,
+		paymentService: paymentService,
+		provider:       provider,
+	}
+}
+
+// RecordDispute stores a dispute reported by Stripe against the payment of a
+// PaymentIntent and keeps the payment in line with it. A dispute that opens puts
+// the payment on hold as disputed and tells the order service, so the order is
+// not fulfilled. Once every dispute on the payment is closed it returns to its
+// previous status if the dispute was won, taking into account refunds that
+// succeeded while it was disputed, or is charged back if it was lost. A
+// NotFoundError is returned if the payment is not stored (yet).
+func (s *disputeService) RecordDispute(update *models.Dispute, paymentIntentID string, actor models.Actor) error {
+	payment, err := s.paymentRepo.GetPaymentByTransactionID(paymentIntentID)
+	if err != nil {
+		return err
+	}
+
+	dispute, err := s.disputeRepo.GetDisputeByStripeID(update.StripeDisputeID)
+	switch {
+	case isNotFoundError(err):
+		dispute = update
+		dispute.PaymentID = payment.ID
+		dispute.OrderID = payment.OrderID
+		dispute.PaymentStatusBefore = payment.Status
+		if err := s.disputeRepo.CreateDispute(dispute); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		// Events can arrive out of order; a closed dispute is never reopened.
+		if !dispute.IsOpen() && update.IsOpen() {
+			return nil
+		}
+		dispute.Amount = update.Amount
+		dispute.Reason = update.Reason
+		dispute.Status = update.Status
+		dispute.EvidenceDueBy = update.EvidenceDueBy
+		if err := s.disputeRepo.UpdateDispute(dispute); err != nil {
+			return err
+		}
+	}
+
+	if dispute.IsOpen() {
+		if payment.Status == models.PaymentStatusDisputed {
+			return nil
+		}
+		if !models.CanTransitionPayment(payment.Status, models.PaymentStatusDisputed) {
+			utils.Warn("Dispute opened on a payment that cannot be disputed", map[string]interface{}{
+				"payment_id": payment.ID,
+				"dispute_id": dispute.StripeDisputeID,
+				"status":     payment.Status,
+			})
+			return nil
+		}
+
+		note := fmt.Sprintf("Dispute %s opened for %s: %s", dispute.StripeDisputeID, dispute.Amount, dispute.Reason)
+		return s.paymentRepo.UpdatePaymentStatus(payment.ID.String(), models.PaymentStatusDisputed, actor.Change(models.PaymentActionDisputed, note).NotifyOrder("payment_disputed"))
+	}
+
+	if payment.Status != models.PaymentStatusDisputed {
+		return nil
+	}
+
+	open, err := s.disputeRepo.CountOpenDisputes(payment.ID.String())
+	if err != nil {
+		return err
+	}
+	if open > 0 {
+		return nil
+	}
+
+	note := fmt.Sprintf("Dispute %s closed as %s", dispute.StripeDisputeID, dispute.Status)
+	if dispute.Status == models.DisputeStatusLost {
+		return s.paymentRepo.UpdatePaymentStatus(payment.ID.String(), models.PaymentStatusChargedBack, actor.Change(models.PaymentActionDisputeClosed, note).NotifyOrder("dispute_lost"))
+	}
+
+	status := dispute.PaymentStatusBefore
+	if !models.CanTransitionPayment(models.PaymentStatusDisputed, status) {
+		status = models.PaymentStatusSuccessful
+	}
+	if err := s.paymentRepo.UpdatePaymentStatus(payment.ID.String(), status, actor.Change(models.PaymentActionDisputeClosed, note).NotifyOrder("dispute_won")); err != nil {
+		return err
+	}
+
+	// Refunds that succeeded during the dispute left the payment's status alone.
+	return s.paymentService.SyncRefundedStatus(payment.ID.String(), actor)
+}
+
+func (s *disputeService) ListOpenDisputes(page int32, limit int32) ([]models.Dispute, int64, error) {
+	return s.disputeRepo.ListDisputesByStatus(models.OpenDisputeStatuses, page, limit)
+}
+
+// UpdateDisputeEvidence sends evidence for an open dispute to Stripe, where it
+// is staged until it is submitted. Evidence can no longer be changed once it
+// has been submitted.
+func (s *disputeService) UpdateDisputeEvidence(disputeID string, evidence map[string]string, submit bool, actor models.Actor, idempotencyKey string) (*models.Dispute, error) {
+	invalid := map[string]string{}
+	for field := range evidence {
+		if !slices.Contains(models.DisputeEvidenceFields, field) {
+			invalid["evidence."+field] = "Unknown evidence field"
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, errors.NewValidationErrors(invalid)
+	}
+	if len(evidence) == 0 && !submit {
+		return nil, errors.NewValidationError("evidence", "Evidence is required unless it is being submitted")
+	}
+
+	dispute, err := s.disputeRepo.GetDispute(disputeID)
+	if err != nil {
+		return nil, err
+	}
+	if !dispute.IsOpen() {
+		return nil, errors.NewConflictError(fmt.Sprintf("Dispute '%s' is %s and no longer accepts evidence", disputeID, dispute.Status))
+	}
+	if dispute.EvidenceSubmittedAt != nil {
+		return nil, errors.NewConflictError(fmt.Sprintf("Evidence for dispute '%s' has already been submitted", disputeID))
+	}
+
+	if idempotencyKey != "" {
+		idempotencyKey = "dispute:" + idempotencyKey
+	}
+	updated, err := s.provider.UpdateDisputeEvidence(providers.DisputeEvidenceRequest{
+		DisputeID:      dispute.StripeDisputeID,
+		Evidence:       evidence,
+		Submit:         submit,
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := map[string]string{}
+	for field, value := range dispute.Evidence {
+		merged[field] = value
+	}
+	for field, value := range evidence {
+		merged[field] = value
+	}
+
+	var submittedAt *time.Time
+	if submit {
+		now := time.Now()
+		submittedAt = &now
+	}
+	if err := s.disputeRepo.RecordEvidence(dispute.ID.String(), merged, updated.Status, submittedAt); err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(evidence))
+	for field := range evidence {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+
+	note := fmt.Sprintf("Evidence staged for dispute %s", dispute.StripeDisputeID)
+	if submit {
+		note = fmt.Sprintf("Evidence submitted for dispute %s", dispute.StripeDisputeID)
+	}
+	if len(fields) > 0 {
+		note = fmt.Sprintf("%s: %s", note, strings.Join(fields, ", "))
+	}
+	if err := s.paymentRepo.RecordPaymentChange(dispute.PaymentID.String(), actor.Change(models.PaymentActionDisputeEvidence, note)); err != nil {
+		return nil, err
+	}
+
+	return s.disputeRepo.GetDispute(dispute.ID.String())
+}
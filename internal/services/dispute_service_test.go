@@ -0,0 +1,196 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/providers"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v81"
+)
+
+type memoryDisputeRepository struct {
+	mu       sync.Mutex
+	disputes []*models.Dispute
+}
+
+func (r *memoryDisputeRepository) CreateDispute(dispute *models.Dispute) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dispute.ID = uuid.New()
+	stored := *dispute
+	r.disputes = append(r.disputes, &stored)
+	return nil
+}
+
+func (r *memoryDisputeRepository) find(match func(*models.Dispute) bool, what string) (*models.Dispute, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, dispute := range r.disputes {
+		if match(dispute) {
+			copied := *dispute
+			return &copied, nil
+		}
+	}
+	return nil, errors.NewNotFoundError(fmt.Sprintf("Dispute with %s not found", what))
+}
+
+func (r *memoryDisputeRepository) GetDispute(disputeID string) (*models.Dispute, error) {
+	return r.find(func(d *models.Dispute) bool { return d.ID.String() == disputeID }, "ID "+disputeID)
+}
+
+func (r *memoryDisputeRepository) GetDisputeByStripeID(stripeDisputeID string) (*models.Dispute, error) {
+	return r.find(func(d *models.Dispute) bool { return d.StripeDisputeID == stripeDisputeID }, "Stripe ID "+stripeDisputeID)
+}
+
+func (r *memoryDisputeRepository) UpdateDispute(dispute *models.Dispute) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.disputes {
+		if existing.ID == dispute.ID {
+			stored := *dispute
+			r.disputes[i] = &stored
+			return nil
+		}
+	}
+	return errors.NewNotFoundError(fmt.Sprintf("Dispute with ID '%s' not found", dispute.ID))
+}
+
+func (r *memoryDisputeRepository) RecordEvidence(disputeID string, evidence map[string]string, status string, submittedAt *time.Time) error {
+	return nil
+}
+
+func (r *memoryDisputeRepository) CountOpenDisputes(paymentID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var open int64
+	for _, dispute := range r.disputes {
+		if dispute.PaymentID.String() == paymentID && dispute.IsOpen() {
+			open++
+		}
+	}
+	return open, nil
+}
+
+func (r *memoryDisputeRepository) ListDisputesByStatus(statuses []string, page int32, limit int32) ([]models.Dispute, int64, error) {
+	return nil, 0, nil
+}
+
+var _ repositories.DisputeRepository = (*memoryDisputeRepository)(nil)
+
+var disputeActor = models.Actor{ID: "stripe:evt_test", Source: models.ChangeSourceWebhook}
+
+func newDisputeFixture(t *testing.T) (*paymentServiceFixture, DisputeService, *models.Payment) {
+	t.Helper()
+
+	f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+	payment := &models.Payment{
+		OrderID:       uuid.MustParse(f.order.OrderId),
+		CustomerID:    uuid.MustParse(f.order.CustomerId),
+		TransactionID: "pi_disputed",
+		Amount:        money.New(2999, "cad"),
+		Status:        models.PaymentStatusSuccessful,
+	}
+	if err := f.payments.StorePayment(payment, disputeActor.Change(models.PaymentActionCreated, "")); err != nil {
+		t.Fatal(err)
+	}
+
+	return f, NewDisputeService(&memoryDisputeRepository{}, f.payments, f.service, f.provider), payment
+}
+
+func TestRecordDisputeWonAfterRefunds(t *testing.T) {
+	tests := []struct {
+		name     string
+		refunded int64
+		want     string
+	}{
+		{"no refunds", 0, models.PaymentStatusSuccessful},
+		{"partial refund", 1000, models.PaymentStatusPartiallyRefunded},
+		{"full refund", 2999, models.PaymentStatusRefunded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, disputes, payment := newDisputeFixture(t)
+
+			opened := &models.Dispute{StripeDisputeID: "dp_test", Amount: payment.Amount, Reason: "fraudulent", Status: models.DisputeStatusNeedsResponse}
+			if err := disputes.RecordDispute(opened, payment.TransactionID, disputeActor); err != nil {
+				t.Fatalf("opening the dispute: %v", err)
+			}
+
+			// A refund that succeeds during the dispute leaves the payment disputed.
+			if tt.refunded > 0 {
+				if err := f.refunds.RecordRefund(&models.Refund{PaymentID: payment.ID, Amount: money.New(tt.refunded, "cad"), Reason: "requested_by_customer", Status: models.RefundStatusSucceeded}); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.service.SyncRefundedStatus(payment.ID.String(), disputeActor); err != nil {
+					t.Fatal(err)
+				}
+				if disputed, _ := f.payments.GetPayment(payment.ID.String()); disputed.Status != models.PaymentStatusDisputed {
+					t.Fatalf("payment is %s during the dispute, want disputed", disputed.Status)
+				}
+			}
+
+			won := &models.Dispute{StripeDisputeID: "dp_test", Amount: payment.Amount, Reason: "fraudulent", Status: models.DisputeStatusWon}
+			if err := disputes.RecordDispute(won, payment.TransactionID, disputeActor); err != nil {
+				t.Fatalf("closing the dispute: %v", err)
+			}
+
+			got, _ := f.payments.GetPayment(payment.ID.String())
+			if got.Status != tt.want {
+				t.Errorf("payment status = %q, want %q", got.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordDisputeLost(t *testing.T) {
+	f, disputes, payment := newDisputeFixture(t)
+
+	for _, status := range []string{models.DisputeStatusNeedsResponse, models.DisputeStatusLost} {
+		update := &models.Dispute{StripeDisputeID: "dp_test", Amount: payment.Amount, Reason: "fraudulent", Status: status}
+		if err := disputes.RecordDispute(update, payment.TransactionID, disputeActor); err != nil {
+			t.Fatalf("recording the dispute as %s: %v", status, err)
+		}
+	}
+
+	got, _ := f.payments.GetPayment(payment.ID.String())
+	if got.Status != models.PaymentStatusChargedBack {
+		t.Errorf("payment status = %q, want charged_back", got.Status)
+	}
+}
+
+func TestDisputeWebhookForUnknownPaymentIsRetried(t *testing.T) {
+	f, disputes, _ := newDisputeFixture(t)
+	webhooks := &webhookService{paymentService: f.service, disputeService: disputes}
+
+	raw, _ := json.Marshal(map[string]interface{}{
+		"id":             "dp_early",
+		"object":         "dispute",
+		"amount":         2999,
+		"currency":       "cad",
+		"reason":         "fraudulent",
+		"status":         "needs_response",
+		"payment_intent": "pi_not_stored_yet",
+	})
+	event := stripe.Event{
+		ID:   "evt_early",
+		Type: stripe.EventTypeChargeDisputeCreated,
+		Data: &stripe.EventData{Raw: raw},
+	}
+
+	if err := webhooks.handleDisputeUpdated(event); !isNotFoundError(err) {
+		t.Errorf("handleDisputeUpdated = %v, want a not found error so the event is retried", err)
+	}
+}
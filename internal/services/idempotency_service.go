@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+)
+
+// idempotencyLockTimeout is how long a key may stay in progress before a retry
+// is allowed to take it over from a request that never finished.
+const idempotencyLockTimeout = 5 * time.Minute
+
+type IdempotencyService interface {
+	Begin(method string, key string, requestHash string) ([]byte, bool, error)
+	Complete(method string, key string, response []byte) error
+	Release(method string, key string) error
+}
+
+type idempotencyService struct {
+	idempotencyKeyRepo repositories.IdempotencyKeyRepository
+}
+
+func NewIdempotencyService(idempotencyKeyRepo repositories.IdempotencyKeyRepository) IdempotencyService {
+	return &idempotencyService{idempotencyKeyRepo}
+}
+
+// Begin reserves the key for a request. If the key was already completed for the
+// same request, its stored response is returned with replayed set, and the caller
+// must not run the request again. Reusing a key for a different request, or while
+// the first request is still running, is a conflict.
+func (s *idempotencyService) Begin(method string, key string, requestHash string) ([]byte, bool, error) {
+	existing, reserved, err := s.idempotencyKeyRepo.ReserveKey(&models.IdempotencyKey{
+		Key:         key,
+		Method:      method,
+		RequestHash: requestHash,
+	}, time.Now().Add(-idempotencyLockTimeout))
+	if err != nil {
+		return nil, false, err
+	}
+	if reserved {
+		return nil, false, nil
+	}
+
+	if existing.RequestHash != requestHash {
+		return nil, false, errors.NewConflictError(fmt.Sprintf("Idempotency key '%s' was already used with a different request", key))
+	}
+
+	if existing.Status != models.IdempotencyKeyStatusCompleted {
+		return nil, false, errors.NewConflictError(fmt.Sprintf("A request with idempotency key '%s' is still in progress", key))
+	}
+
+	return existing.Response, true, nil
+}
+
+func (s *idempotencyService) Complete(method string, key string, response []byte) error {
+	return s.idempotencyKeyRepo.CompleteKey(method, key, response)
+}
+
+func (s *idempotencyService) Release(method string, key string) error {
+	return s.idempotencyKeyRepo.ReleaseKey(method, key)
+}
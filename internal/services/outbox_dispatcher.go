@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/proto"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+)
+
+const (
+	// outboxDeliveryTimeout bounds a single delivery. Messages claimed by a
+	// dispatcher that dies are leased for this long before another one retries them.
+	outboxDeliveryTimeout = 30 * time.Second
+	outboxBatchSize       = 100
+	outboxMaxRetryBackoff = 15 * time.Minute
+)
+
+type OutboxDispatcher interface {
+	DispatchPending() error
+}
+
+type outboxDispatcher struct {
+	outboxRepo  repositories.OutboxRepository
+	orderClient proto.OrderServiceClient
+	cfg         *config.Config
+}
+
+func NewOutboxDispatcher(outboxRepo repositories.OutboxRepository, orderService *proto.OrderServiceClient, cfg *config.Config) OutboxDispatcher {
+	return &outboxDispatcher{
+		outboxRepo:  outboxRepo,
+		orderClient: *orderService,
+		cfg:         cfg,
+	}
+}
+
+// DispatchPending delivers the outbox messages that are due, backing off
+// exponentially on messages that keep failing. Delivery is at least once, so
+// receivers must tolerate the same update arriving twice. Failed deliveries are
+// rescheduled rather than returned; only a failure to claim messages is.
+// Messages that still fail after the configured number of attempts are
+// dead-lettered, so they stop holding back later updates for the same order.
+func (d *outboxDispatcher) DispatchPending() error {
+	messages, err := d.outboxRepo.ClaimDueMessages(time.Now().Add(outboxDeliveryTimeout), outboxBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if err := d.deliver(message); err != nil {
+			d.recordFailedDelivery(message, err)
+			continue
+		}
+
+		if err := d.outboxRepo.MarkMessageDelivered(message.ID.String()); err != nil {
+			utils.Error("Failed to mark outbox message delivered", map[string]interface{}{
+				"message_id": message.ID,
+				"error":      err.Error(),
+			})
+		}
+	}
+
+	return nil
+}
+
+func (d *outboxDispatcher) recordFailedDelivery(message models.OutboxMessage, deliveryErr error) {
+	fields := map[string]interface{}{
+		"message_id":   message.ID,
+		"topic":        message.Topic,
+		"aggregate_id": message.AggregateID,
+		"payload":      string(message.Payload),
+		"attempts":     message.Attempts,
+		"error":        deliveryErr.Error(),
+	}
+
+	var err error
+	if message.Attempts >= d.cfg.OutboxMaxAttempts {
+		utils.Error("Outbox message dead-lettered", fields)
+		err = d.outboxRepo.MarkMessageDeadLettered(message.ID.String(), deliveryErr.Error())
+	} else {
+		utils.Warn("Outbox message delivery failed, will retry", fields)
+		nextAttemptAt := time.Now().Add(retryBackoff(message.Attempts, outboxMaxRetryBackoff))
+		err = d.outboxRepo.MarkMessageFailed(message.ID.String(), deliveryErr.Error(), nextAttemptAt)
+	}
+	if err != nil {
+		utils.Error("Failed to record outbox delivery failure", map[string]interface{}{
+			"message_id": message.ID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+func (d *outboxDispatcher) deliver(message models.OutboxMessage) error {
+	switch message.Topic {
+	case models.OutboxTopicOrderStatus:
+		var update models.OrderStatusUpdate
+		if err := json.Unmarshal(message.Payload, &update); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), outboxDeliveryTimeout)
+		defer cancel()
+
+		resp, err := d.orderClient.UpdateOrderStatus(ctx, &proto.UpdateOrderStatusRequest{
+			OrderId:    update.OrderID,
+			CustomerId: "payment_service",
+			Status:     update.Status,
+		})
+		if err != nil {
+			return err
+		}
+		if !resp.Success {
+			return fmt.Errorf("order service rejected status %s: %s", update.Status, resp.Message)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown outbox topic %s", message.Topic)
+	}
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/proto"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+)
+
+// memoryOutboxRepository keeps messages in memory and claims them as the
+// database repository does: due pending messages, oldest first, and only once
+// every older message for the same aggregate has been delivered.
+type memoryOutboxRepository struct {
+	mu       sync.Mutex
+	messages []*models.OutboxMessage
+}
+
+func (r *memoryOutboxRepository) add(t *testing.T, orderID string, status string) *models.OutboxMessage {
+	t.Helper()
+
+	payload, err := json.Marshal(models.OrderStatusUpdate{OrderID: orderID, Status: status})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message := &models.OutboxMessage{
+		ID:            uuid.New(),
+		Topic:         models.OutboxTopicOrderStatus,
+		AggregateID:   orderID,
+		Payload:       payload,
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: time.Now(),
+		CreatedAt:     time.Now().Add(time.Duration(len(r.messages)) * time.Millisecond),
+	}
+	r.messages = append(r.messages, message)
+	return message
+}
+
+func (r *memoryOutboxRepository) ClaimDueMessages(leaseUntil time.Time, limit int) ([]models.OutboxMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.Slice(r.messages, func(i, j int) bool { return r.messages[i].CreatedAt.Before(r.messages[j].CreatedAt) })
+
+	now := time.Now()
+	held := map[string]bool{}
+	var claimed []models.OutboxMessage
+	for _, message := range r.messages {
+		if message.Status != models.OutboxStatusPending {
+			continue
+		}
+		blocked := held[message.AggregateID]
+		held[message.AggregateID] = true
+		if blocked || message.NextAttemptAt.After(now) || len(claimed) == limit {
+			continue
+		}
+
+		message.Attempts++
+		message.NextAttemptAt = leaseUntil
+		claimed = append(claimed, *message)
+	}
+	return claimed, nil
+}
+
+func (r *memoryOutboxRepository) update(messageID string, apply func(*models.OutboxMessage)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, message := range r.messages {
+		if message.ID.String() == messageID {
+			apply(message)
+			return nil
+		}
+	}
+	return errors.NewNotFoundError(fmt.Sprintf("Outbox message '%s' not found", messageID))
+}
+
+func (r *memoryOutboxRepository) MarkMessageDelivered(messageID string) error {
+	return r.update(messageID, func(message *models.OutboxMessage) {
+		now := time.Now()
+		message.Status = models.OutboxStatusDelivered
+		message.LastError = ""
+		message.DeliveredAt = &now
+	})
+}
+
+func (r *memoryOutboxRepository) MarkMessageFailed(messageID string, lastError string, nextAttemptAt time.Time) error {
+	return r.update(messageID, func(message *models.OutboxMessage) {
+		message.LastError = lastError
+		message.NextAttemptAt = nextAttemptAt
+	})
+}
+
+func (r *memoryOutboxRepository) MarkMessageDeadLettered(messageID string, lastError string) error {
+	return r.update(messageID, func(message *models.OutboxMessage) {
+		message.Status = models.OutboxStatusDeadLetter
+		message.LastError = lastError
+	})
+}
+
+func (r *memoryOutboxRepository) get(messageID uuid.UUID) models.OutboxMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, message := range r.messages {
+		if message.ID == messageID {
+			return *message
+		}
+	}
+	return models.OutboxMessage{}
+}
+
+// makeDue ends the backoff of every pending message.
+func (r *memoryOutboxRepository) makeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, message := range r.messages {
+		message.NextAttemptAt = time.Now()
+	}
+}
+
+var _ repositories.OutboxRepository = (*memoryOutboxRepository)(nil)
+
+// orderStatusRecorder records the statuses the order service accepts and
+// rejects as many updates as asked.
+type orderStatusRecorder struct {
+	proto.OrderServiceClient
+	rejections int
+	accepted   []string
+}
+
+func (c *orderStatusRecorder) UpdateOrderStatus(ctx context.Context, in *proto.UpdateOrderStatusRequest, opts ...grpc.CallOption) (*proto.UpdateOrderStatusResponse, error) {
+	if c.rejections > 0 {
+		c.rejections--
+		return nil, fmt.Errorf("order service unavailable")
+	}
+	c.accepted = append(c.accepted, in.Status)
+	return &proto.UpdateOrderStatusResponse{Success: true}, nil
+}
+
+func newOutboxFixture(maxAttempts int) (OutboxDispatcher, *memoryOutboxRepository, *orderStatusRecorder) {
+	outbox := &memoryOutboxRepository{}
+	recorder := &orderStatusRecorder{}
+	var orderClient proto.OrderServiceClient = recorder
+	return NewOutboxDispatcher(outbox, &orderClient, &config.Config{OutboxMaxAttempts: maxAttempts}), outbox, recorder
+}
+
+func TestOutboxRetriesFailedDeliveriesInOrder(t *testing.T) {
+	dispatcher, outbox, orders := newOutboxFixture(3)
+	orderID := uuid.NewString()
+	paid := outbox.add(t, orderID, "paid")
+	refunded := outbox.add(t, orderID, "refunded")
+	orders.rejections = 1
+
+	if err := dispatcher.DispatchPending(); err != nil {
+		t.Fatalf("DispatchPending: %v", err)
+	}
+	failed := outbox.get(paid.ID)
+	if failed.Status != models.OutboxStatusPending || failed.LastError == "" || !failed.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("failed message is %s with error %q due at %v, want pending with the error and a later attempt", failed.Status, failed.LastError, failed.NextAttemptAt)
+	}
+	// The later update waits for the earlier one.
+	if len(orders.accepted) != 0 {
+		t.Fatalf("order service accepted %v while the first update was failing", orders.accepted)
+	}
+
+	// Nothing is retried while the message backs off.
+	if err := dispatcher.DispatchPending(); err != nil {
+		t.Fatal(err)
+	}
+	if len(orders.accepted) != 0 {
+		t.Fatalf("order service accepted %v during the backoff", orders.accepted)
+	}
+
+	outbox.makeDue()
+	if err := dispatcher.DispatchPending(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.DispatchPending(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(orders.accepted) != "[paid refunded]" {
+		t.Errorf("order service accepted %v, want [paid refunded]", orders.accepted)
+	}
+	for _, message := range []*models.OutboxMessage{paid, refunded} {
+		if got := outbox.get(message.ID); got.Status != models.OutboxStatusDelivered {
+			t.Errorf("message is %s, want delivered", got.Status)
+		}
+	}
+}
+
+func TestOutboxDeadLettersAfterMaxAttempts(t *testing.T) {
+	dispatcher, outbox, orders := newOutboxFixture(2)
+	orderID := uuid.NewString()
+	paid := outbox.add(t, orderID, "paid")
+	refunded := outbox.add(t, orderID, "refunded")
+	orders.rejections = 2
+
+	for range 2 {
+		if err := dispatcher.DispatchPending(); err != nil {
+			t.Fatalf("DispatchPending: %v", err)
+		}
+		outbox.makeDue()
+	}
+
+	if got := outbox.get(paid.ID); got.Status != models.OutboxStatusDeadLetter || got.Attempts != 2 {
+		t.Fatalf("message is %s after %d attempts, want dead_letter after 2", got.Status, got.Attempts)
+	}
+
+	// The dead letter no longer holds back the order's later updates.
+	if err := dispatcher.DispatchPending(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(orders.accepted) != "[refunded]" {
+		t.Errorf("order service accepted %v, want [refunded]", orders.accepted)
+	}
+	if got := outbox.get(refunded.ID); got.Status != models.OutboxStatusDelivered {
+		t.Errorf("later message is %s, want delivered", got.Status)
+	}
+}
@@ -2,146 +2,1344 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/policies"
 	"github.com/PharmaKart/payment-svc/internal/proto"
+	"github.com/PharmaKart/payment-svc/internal/providers"
 	"github.com/PharmaKart/payment-svc/internal/repositories"
 	"github.com/PharmaKart/payment-svc/pkg/config"
-	"github.com/stripe/stripe-go/v81"
-	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	// checkoutSessionReuseMargin is how much time an open session must have left
+	// to be handed out again, so the customer is not sent to a page about to expire.
+	checkoutSessionReuseMargin = 10 * time.Minute
+	// authorizationWindow is how long a card authorization is assumed to be held
+	// when the provider does not report when it will be released.
+	authorizationWindow = 7 * 24 * time.Hour
 )
 
 type StripeResponse struct {
-	URL string
+	URL       string
+	PaymentID string
+	SessionID string
+	ExpiresAt time.Time
 }
 
 type PaymentService interface {
-	GeneratePaymentURL(orderId string, customerId string) (StripeResponse, error)
-	StorePayment(payment *models.Payment) (string, error)
-	RefundPayment(transactionId string) error
+	GeneratePaymentURL(orderId string, customerId string, idempotencyKey string) (StripeResponse, error)
+	StorePayment(payment *models.Payment, actor models.Actor) (string, error)
+	RefundPayment(transactionId string, amount money.Money, reason string, actor models.Actor, idempotencyKey string) (*models.Refund, *models.RefundApproval, error)
+	ApproveRefund(approvalID string, approver models.Actor, comment string) (*models.RefundApproval, *models.Refund, error)
+	RejectRefund(approvalID string, approver models.Actor, comment string) (*models.RefundApproval, error)
+	SyncRefund(stripeRefundID string, actor models.Actor) error
 	GetPaymentByTransactionID(transactionID string) (*models.Payment, error)
 	GetPayment(paymentID string) (*models.Payment, error)
 	GetPaymentByOrderID(orderID string) (*models.Payment, error)
+	ListPaymentAttempts(orderID string) ([]models.Payment, error)
+	GetPaymentTimeline(orderID string) ([]models.PaymentStatusChange, error)
+	UpdateCheckoutSessionStatus(stripeSessionID string, status string) error
+	ExpireCheckoutSession(stripeSessionID string, actor models.Actor) error
+	ReconcilePendingPayment(payment *models.Payment, actor models.Actor) error
+	ReconcileCheckoutSession(stripeSessionID string, actor models.Actor) (*models.Payment, error)
+	SyncPaymentIntent(paymentIntentID string, actor models.Actor) error
+	SyncRefundedStatus(paymentID string, actor models.Actor) error
+	CapturePayment(orderID string, actor models.Actor, idempotencyKey string) (*models.Payment, error)
+	VoidPayment(orderID string, reason string, actor models.Actor, idempotencyKey string) (*models.Payment, error)
+	ResolveManualReview(paymentID string, note string, actor models.Actor) (*models.Payment, error)
 }
 
 type paymentService struct {
-	paymentRepo repositories.PaymentRepository
-	orderClient proto.OrderServiceClient
-	cfg         *config.Config
+	paymentRepo         repositories.PaymentRepository
+	refundRepo          repositories.RefundRepository
+	refundApprovalRepo  repositories.RefundApprovalRepository
+	checkoutSessionRepo repositories.CheckoutSessionRepository
+	orderClient         proto.OrderServiceClient
+	provider            providers.PaymentProvider
+	prescriptionPolicy  policies.PrescriptionPolicy
+	cfg                 *config.Config
 }
 
-func NewPaymentService(paymentRepo repositories.PaymentRepository, orderService *proto.OrderServiceClient, cfg *config.Config) PaymentService {
+func NewPaymentService(paymentRepo repositories.PaymentRepository, refundRepo repositories.RefundRepository, refundApprovalRepo repositories.RefundApprovalRepository, checkoutSessionRepo repositories.CheckoutSessionRepository, orderService *proto.OrderServiceClient, provider providers.PaymentProvider, prescriptionPolicy policies.PrescriptionPolicy, cfg *config.Config) PaymentService {
 	return &paymentService{
-		paymentRepo: paymentRepo,
-		orderClient: *orderService,
-		cfg:         cfg,
+		paymentRepo:         paymentRepo,
+		refundRepo:          refundRepo,
+		refundApprovalRepo:  refundApprovalRepo,
+		checkoutSessionRepo: checkoutSessionRepo,
+		orderClient:         *orderService,
+		provider:            provider,
+		prescriptionPolicy:  prescriptionPolicy,
+		cfg:                 cfg,
 	}
 }
 
-func (s *paymentService) GeneratePaymentURL(orderID string, customerID string) (StripeResponse, error) {
-	stripe.Key = s.cfg.StripeSecretKey
+func (s *paymentService) GeneratePaymentURL(orderID string, customerID string, idempotencyKey string) (StripeResponse, error) {
+	orderUUID, err := uuid.Parse(orderID)
+	if err != nil {
+		return StripeResponse{}, errors.NewValidationError("order_id", fmt.Sprintf("Invalid UUID: %s", orderID))
+	}
+
+	if customerID == "" {
+		return StripeResponse{}, errors.NewAuthError("A customer ID is required to pay for an order")
+	}
+
+	actor := models.Actor{
+		ID:     customerID,
+		Source: models.ChangeSourceRPC,
+	}
 
 	order, err := s.orderClient.GetOrder(context.Background(), &proto.GetOrderRequest{
 		OrderId:    orderID,
-		CustomerId: "admin",
+		CustomerId: customerID,
 	})
 	if err != nil {
 		return StripeResponse{}, err
 	}
+	if !order.Success {
+		return StripeResponse{}, orderLookupError(orderID, order.Error)
+	}
+
+	// Only the customer who placed the order can check out; the webhook takes the
+	// payment's customer from the session metadata.
+	if order.CustomerId != customerID {
+		return StripeResponse{}, errors.NewAuthError("You are not authorized to pay for this order")
+	}
+
+	if !slices.Contains(s.cfg.PayableOrderStatuses, order.Status) {
+		return StripeResponse{}, errors.NewBadRequestError(fmt.Sprintf("Order '%s' is %s and cannot be paid", orderID, order.Status))
+	}
+
+	paid, err := s.paymentRepo.GetPaymentByOrderID(orderID)
+	if err != nil && !isNotFoundError(err) {
+		return StripeResponse{}, err
+	}
+	if err == nil && slices.Contains(models.SuccessfulPaymentStatuses, paid.Status) {
+		return StripeResponse{}, errors.NewConflictError(fmt.Sprintf("Order '%s' has already been paid", orderID))
+	}
+
+	if blocking := s.prescriptionPolicy.Check(order); len(blocking) > 0 {
+		return StripeResponse{}, errors.NewValidationErrors(blocking)
+	}
+
+	currency := s.cfg.DefaultCurrency
+	if order.Currency != nil && *order.Currency != "" {
+		currency = strings.ToLower(*order.Currency)
+	}
+	if !slices.Contains(s.cfg.SupportedCurrencies, currency) {
+		return StripeResponse{}, errors.NewBadRequestError(fmt.Sprintf("Currency '%s' is not supported", currency))
+	}
+
+	total, err := orderTotal(order, currency)
+	if err != nil {
+		return StripeResponse{}, err
+	}
 
-	lineItems := []*stripe.CheckoutSessionLineItemParams{}
+	// Prescription orders are only authorized at checkout and captured once a
+	// pharmacist has verified the prescription.
+	captureMethod := models.CaptureMethodAutomatic
+	if isPrescriptionOrder(order) {
+		captureMethod = models.CaptureMethodManual
+	}
+
+	lineItems := []providers.LineItem{}
 
 	for _, item := range order.Items {
-		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
-			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-				Currency: stripe.String("cad"),
-				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-					Name: stripe.String(item.ProductName),
-				},
-				UnitAmount: stripe.Int64(int64(item.Price * 100)),
-			},
-			Quantity: stripe.Int64(int64(item.Quantity)),
+		lineItems = append(lineItems, providers.LineItem{
+			Name:       item.ProductName,
+			UnitAmount: money.FromMajor(item.Price, currency),
+			Quantity:   int64(item.Quantity),
 		})
 	}
 
 	if order.ShippingCost > 0 {
-		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
-			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-				Currency: stripe.String("cad"),
-				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-					Name: stripe.String("Shipping"),
-				},
-				UnitAmount: stripe.Int64(int64(order.ShippingCost * 100)),
-			},
-			Quantity: stripe.Int64(1),
+		lineItems = append(lineItems, providers.LineItem{
+			Name:       "Shipping",
+			UnitAmount: money.FromMajor(order.ShippingCost, currency),
+			Quantity:   1,
 		})
 	}
 
-	params := &stripe.CheckoutSessionParams{
-		SuccessURL:        stripe.String(s.cfg.FrontendURL + "/orders/" + orderID),
-		LineItems:         lineItems,
-		ClientReferenceID: stripe.String(orderID),
-		Mode:              stripe.String(string(stripe.CheckoutSessionModePayment)),
+	// Hand out the order's open session again rather than letting the customer
+	// pay twice. A session that is about to expire, or was created for a
+	// different total or capture method, is expired first so it can no longer be
+	// paid.
+	open, err := s.checkoutSessionRepo.GetOpenSessionByOrderID(orderID)
+	switch {
+	case err == nil:
+		if open.Amount == total && open.CaptureMethod == captureMethod && time.Now().Add(checkoutSessionReuseMargin).Before(open.ExpiresAt) {
+			return s.checkoutResponse(open, order.CustomerId, actor)
+		}
+		if err := s.expireCheckoutSession(open, actor); err != nil {
+			return StripeResponse{}, err
+		}
+	case !isNotFoundError(err):
+		return StripeResponse{}, err
 	}
 
-	params.AddMetadata("customer_id", customerID)
-	params.AddMetadata("order_id", orderID)
+	checkoutRequest := providers.CheckoutSessionRequest{
+		OrderID:    orderID,
+		Currency:   currency,
+		LineItems:  lineItems,
+		SuccessURL: s.cfg.FrontendURL + "/orders/" + orderID,
+		Metadata: map[string]string{
+			"customer_id": order.CustomerId,
+			"order_id":    orderID,
+		},
+		ManualCapture: captureMethod == models.CaptureMethodManual,
+	}
+	if idempotencyKey != "" {
+		checkoutRequest.IdempotencyKey = "checkout:" + idempotencyKey
+	}
 
-	session, err := session.New(params)
+	created, err := s.provider.CreateCheckoutSession(checkoutRequest)
+	if err != nil {
+		return StripeResponse{}, err
+	}
+
+	stored := &models.CheckoutSession{
+		StripeSessionID: created.ID,
+		OrderID:         orderUUID,
+		URL:             created.URL,
+		Amount:          created.Amount,
+		CaptureMethod:   captureMethod,
+		Status:          models.CheckoutSessionStatusOpen,
+		ExpiresAt:       created.ExpiresAt,
+	}
+	if err := s.checkoutSessionRepo.CreateSession(stored); err != nil {
+		// A concurrent request stored its session first; withdraw ours so only one
+		// can be paid.
+		if _, expireErr := s.provider.ExpireCheckoutSession(created.ID); expireErr != nil {
+			utils.Error("Failed to expire duplicate checkout session", map[string]interface{}{
+				"session_id": created.ID,
+				"order_id":   orderID,
+				"error":      expireErr.Error(),
+			})
+		}
+		return StripeResponse{}, err
+	}
+
+	return s.checkoutResponse(stored, order.CustomerId, actor)
+}
+
+// checkoutResponse returns the session together with the pending payment it is
+// paid into, creating the payment if it does not exist yet.
+func (s *paymentService) checkoutResponse(stored *models.CheckoutSession, orderCustomerID string, actor models.Actor) (StripeResponse, error) {
+	payment, err := s.paymentRepo.GetPaymentByCheckoutSessionID(stored.StripeSessionID)
+	if isNotFoundError(err) {
+		customerUUID, parseErr := uuid.Parse(orderCustomerID)
+		if parseErr != nil {
+			return StripeResponse{}, errors.NewInternalError(fmt.Errorf("order has invalid customer ID %q", orderCustomerID))
+		}
+
+		payment = &models.Payment{
+			OrderID:           stored.OrderID,
+			CustomerID:        customerUUID,
+			TransactionID:     stored.StripeSessionID,
+			CheckoutSessionID: stored.StripeSessionID,
+			Amount:            stored.Amount,
+			Status:            models.PaymentStatusPending,
+			CaptureMethod:     stored.CaptureMethod,
+		}
+		err = s.paymentRepo.StorePayment(payment, actor.Change(models.PaymentActionCreated, "Checkout session created"))
+	}
 	if err != nil {
 		return StripeResponse{}, err
 	}
 
 	return StripeResponse{
-		URL: session.URL,
+		URL:       stored.URL,
+		PaymentID: payment.ID.String(),
+		SessionID: stored.StripeSessionID,
+		ExpiresAt: stored.ExpiresAt,
 	}, nil
 }
 
-func (s *paymentService) StorePayment(payment *models.Payment) (string, error) {
-	err := s.paymentRepo.StorePayment(payment)
+// expireCheckoutSession expires a stored session at Stripe and records its final
+// status, expiring the pending payment created for it. A session that was
+// completed in the meantime is a conflict, since the order may already be paid.
+func (s *paymentService) expireCheckoutSession(stored *models.CheckoutSession, actor models.Actor) error {
+	expired, err := s.provider.ExpireCheckoutSession(stored.StripeSessionID)
+	if err != nil {
+		// Stripe refuses to expire a session that is no longer open, so check
+		// whether it completed or expired on its own.
+		current, getErr := s.provider.GetCheckoutSession(stored.StripeSessionID)
+		if getErr != nil || current.Status == models.CheckoutSessionStatusOpen {
+			return err
+		}
+		expired = current
+	}
+
+	if err := s.checkoutSessionRepo.UpdateSessionStatus(stored.StripeSessionID, expired.Status); err != nil {
+		return err
+	}
+
+	if expired.Status == models.CheckoutSessionStatusComplete {
+		return errors.NewConflictError(fmt.Sprintf("Order '%s' already has a completed checkout session", stored.OrderID))
+	}
+
+	payment, err := s.paymentRepo.GetPaymentByCheckoutSessionID(stored.StripeSessionID)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+
+	if payment.Status != models.PaymentStatusPending {
+		return nil
+	}
+	return s.paymentRepo.UpdatePaymentStatus(payment.ID.String(), models.PaymentStatusExpired, actor.Change(models.PaymentActionExpired, "Checkout session expired"))
+}
+
+// UpdateCheckoutSessionStatus records a status reported by Stripe for a session.
+// Sessions created before sessions were tracked are ignored.
+func (s *paymentService) UpdateCheckoutSessionStatus(stripeSessionID string, status string) error {
+	err := s.checkoutSessionRepo.UpdateSessionStatus(stripeSessionID, status)
+	if err != nil && !isNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+// ExpireCheckoutSession records that Stripe expired a session before it was
+// paid, expiring its pending payment. The order is told its payment failed
+// unless a newer session is still open for it, as when GeneratePaymentURL
+// replaced the session.
+func (s *paymentService) ExpireCheckoutSession(stripeSessionID string, actor models.Actor) error {
+	if err := s.UpdateCheckoutSessionStatus(stripeSessionID, models.CheckoutSessionStatusExpired); err != nil {
+		return err
+	}
+
+	payment, err := s.paymentRepo.GetPaymentByCheckoutSessionID(stripeSessionID)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+	if payment.Status != models.PaymentStatusPending {
+		return nil
+	}
+	return s.expirePendingPayment(payment, "Checkout session expired", actor)
+}
+
+// expirePendingPayment expires a payment that will not be paid, telling the
+// order service its payment failed unless a newer session is open for it.
+func (s *paymentService) expirePendingPayment(payment *models.Payment, note string, actor models.Actor) error {
+	orderStatus := "payment_failed"
+	_, err := s.checkoutSessionRepo.GetOpenSessionByOrderID(payment.OrderID.String())
+	switch {
+	case err == nil:
+		orderStatus = ""
+	case !isNotFoundError(err):
+		return err
+	}
+
+	change := actor.Change(models.PaymentActionExpired, note).NotifyOrder(orderStatus)
+	return s.paymentRepo.UpdatePaymentStatus(payment.ID.String(), models.PaymentStatusExpired, change)
+}
+
+// ReconcileCheckoutSession settles the payment of a checkout session from its
+// state at the provider straight away, for providers that send no webhooks.
+func (s *paymentService) ReconcileCheckoutSession(stripeSessionID string, actor models.Actor) (*models.Payment, error) {
+	payment, err := s.paymentRepo.GetPaymentByCheckoutSessionID(stripeSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.ReconcilePendingPayment(payment, actor); err != nil {
+		return nil, err
+	}
+	return s.paymentRepo.GetPayment(payment.ID.String())
+}
+
+// ReconcilePendingPayment settles a payment left pending by a lost webhook from
+// the state of its checkout session and PaymentIntent at the provider. Payments
+// the provider is still working on, such as an open session or a delayed
+// payment still processing, are left pending.
+func (s *paymentService) ReconcilePendingPayment(payment *models.Payment, actor models.Actor) error {
+	if payment.Status != models.PaymentStatusPending {
+		return nil
+	}
+
+	intentID := payment.TransactionID
+	if payment.CheckoutSessionID != "" {
+		session, err := s.provider.GetCheckoutSession(payment.CheckoutSessionID)
+		if providers.IsNotFound(err) {
+			if err := s.UpdateCheckoutSessionStatus(payment.CheckoutSessionID, models.CheckoutSessionStatusExpired); err != nil {
+				return err
+			}
+			return s.expirePendingPayment(payment, "Checkout session was not found at the payment provider", actor)
+		}
+		if err != nil {
+			return err
+		}
+
+		switch session.Status {
+		case models.CheckoutSessionStatusExpired:
+			if err := s.UpdateCheckoutSessionStatus(session.ID, session.Status); err != nil {
+				return err
+			}
+			return s.expirePendingPayment(payment, "Checkout session expired", actor)
+		case models.CheckoutSessionStatusComplete:
+			if err := s.UpdateCheckoutSessionStatus(session.ID, session.Status); err != nil {
+				return err
+			}
+			intentID = session.PaymentIntentID
+		default:
+			return nil
+		}
+	}
+
+	if intentID == "" || intentID == payment.CheckoutSessionID {
+		return nil
+	}
+	if payment.TransactionID != intentID {
+		if err := s.paymentRepo.UpdateTransactionID(payment.ID.String(), intentID); err != nil {
+			return err
+		}
+		payment.TransactionID = intentID
+	}
+
+	if payment.CaptureMethod == models.CaptureMethodManual {
+		return s.SyncPaymentIntent(intentID, actor)
+	}
+
+	intent, err := s.provider.GetPaymentIntent(intentID)
+	if providers.IsNotFound(err) {
+		change := actor.Change(models.PaymentActionStored, fmt.Sprintf("PaymentIntent '%s' was not found at the payment provider", intentID))
+		return s.paymentRepo.UpdatePaymentStatus(payment.ID.String(), models.PaymentStatusFailed, change.NotifyOrder("payment_failed"))
+	}
+	if err != nil {
+		return err
+	}
+
+	settled := &models.Payment{
+		OrderID:           payment.OrderID,
+		CustomerID:        payment.CustomerID,
+		TransactionID:     intentID,
+		CheckoutSessionID: payment.CheckoutSessionID,
+		Amount:            payment.Amount,
+	}
+	switch intent.Status {
+	case "succeeded":
+		settled.Status = models.PaymentStatusSuccessful
+	case "requires_payment_method", "canceled":
+		settled.Status = models.PaymentStatusFailed
+		settled.FailureReason = fmt.Sprintf("PaymentIntent is %s at the payment provider", intent.Status)
+	default:
+		return nil
+	}
+
+	_, err = s.StorePayment(settled, actor)
+	return err
+}
+
+func (s *paymentService) StorePayment(payment *models.Payment, actor models.Actor) (string, error) {
+	if payment.Amount.Currency == "" {
+		payment.Amount.Currency = s.cfg.DefaultCurrency
+	}
+	if !slices.Contains(s.cfg.SupportedCurrencies, payment.Amount.Currency) {
+		return "", errors.NewValidationError("currency", fmt.Sprintf("Currency '%s' is not supported", payment.Amount.Currency))
+	}
+
+	if payment.Status != models.PaymentStatusPending && payment.Status != models.PaymentStatusSuccessful && payment.Status != models.PaymentStatusFailed {
+		return "", errors.NewValidationError("status", fmt.Sprintf("Must be one of: %s, %s, %s", models.PaymentStatusPending, models.PaymentStatusSuccessful, models.PaymentStatusFailed))
+	}
+
+	// A payment that was already stored, for instance by a replayed webhook or
+	// when its checkout session was created, is moved on through the state machine
+	// instead of failing on the unique constraint.
+	existing, err := s.paymentRepo.GetPaymentByTransactionID(payment.TransactionID)
+	if isNotFoundError(err) && payment.CheckoutSessionID != "" {
+		existing, err = s.paymentRepo.GetPaymentByCheckoutSessionID(payment.CheckoutSessionID)
+		if err == nil && existing.TransactionID != payment.TransactionID {
+			err = s.paymentRepo.UpdateTransactionID(existing.ID.String(), payment.TransactionID)
+		}
+	}
+	if isNotFoundError(err) {
+		existing, err = nil, nil
+	}
 	if err != nil {
 		return "", err
 	}
 
-	var status string
-	if payment.Status == "complete" {
-		status = "paid"
+	if existing != nil && existing.CaptureMethod == models.CaptureMethodManual {
+		// A manual capture payment only succeeds once it is captured through
+		// CapturePayment. Until then a completed checkout is no more than an
+		// authorization, which SyncPaymentIntent records.
+		if payment.Status == models.PaymentStatusSuccessful {
+			payment.Status = models.PaymentStatusPending
+		}
+	}
+
+	// Only an operator can release a payment held for review, through
+	// ResolveManualReview. Webhooks are acknowledged so they are not retried.
+	if existing != nil && existing.Status == models.PaymentStatusManualReview {
+		if actor.Source == models.ChangeSourceWebhook {
+			utils.Warn("Ignoring report for a payment held for manual review", map[string]interface{}{
+				"payment_id": existing.ID,
+				"status":     payment.Status,
+			})
+			return "Payment is held for manual review", nil
+		}
+		return "", errors.NewConflictError(fmt.Sprintf("Payment with transaction ID '%s' is held for manual review", payment.TransactionID))
+	}
+
+	// Reporting a payment as pending never moves it back, for instance when the
+	// checkout is reported complete after its authorization was recorded.
+	if existing != nil && payment.Status == models.PaymentStatusPending && existing.Status != models.PaymentStatusPending {
+		return "Payment stored successfully", nil
+	}
+
+	// The caller's word is not enough to mark an order paid. A payment whose
+	// amount does not match the order or what the provider captured is held for review.
+	note := payment.FailureReason
+	if payment.Status == models.PaymentStatusSuccessful && (existing == nil || existing.Status == models.PaymentStatusPending) {
+		mismatch, err := s.verifyPaymentAmount(payment)
+		if err != nil {
+			return "", err
+		}
+		if mismatch != "" {
+			utils.Warn("Payment amount mismatch, holding for manual review", map[string]interface{}{
+				"order_id":       payment.OrderID,
+				"transaction_id": payment.TransactionID,
+				"reason":         mismatch,
+			})
+			payment.Status = models.PaymentStatusManualReview
+			note = mismatch
+		}
+	}
+
+	// The order service is notified through the outbox in the same transaction as
+	// the payment, so a settled payment always reaches the order eventually.
+	orderStatus := ""
+	switch payment.Status {
+	case models.PaymentStatusSuccessful:
+		orderStatus = "paid"
+	case models.PaymentStatusFailed:
+		orderStatus = "payment_failed"
+	}
+
+	if existing != nil {
+		change := actor.Change(models.PaymentActionStored, note).NotifyOrder(orderStatus)
+		if err := s.paymentRepo.UpdatePaymentStatus(existing.ID.String(), payment.Status, change); err != nil {
+			return "", err
+		}
 	} else {
-		status = "payment_failed"
+		change := actor.Change(models.PaymentActionCreated, note).NotifyOrder(orderStatus)
+		if err := s.paymentRepo.StorePayment(payment, change); err != nil {
+			return "", err
+		}
+	}
+
+	if payment.Status == models.PaymentStatusManualReview {
+		return "Payment stored for manual review", nil
+	}
+	return "Payment stored successfully", nil
+}
+
+// verifyPaymentAmount recomputes the order total and compares it with the amount
+// reported for the payment and the amount the provider captured for its
+// PaymentIntent.
+// It returns a description of the first mismatch, or an empty string if they all
+// agree.
+func (s *paymentService) verifyPaymentAmount(payment *models.Payment) (string, error) {
+	mismatch, err := s.orderAmountMismatch(payment)
+	if err != nil || mismatch != "" {
+		return mismatch, err
+	}
+
+	intent, err := s.provider.GetPaymentIntent(payment.TransactionID)
+	if err != nil {
+		if providers.IsNotFound(err) {
+			return fmt.Sprintf("PaymentIntent '%s' was not found at the payment provider", payment.TransactionID), nil
+		}
+		return "", err
+	}
+
+	captured := intent.AmountReceived
+	if captured != payment.Amount {
+		return fmt.Sprintf("Captured amount %s does not match order total %s", captured, payment.Amount), nil
 	}
 
-	_, err = s.orderClient.UpdateOrderStatus(context.Background(), &proto.UpdateOrderStatusRequest{
+	return "", nil
+}
+
+// orderAmountMismatch compares the amount of the payment with the order total,
+// returning a description of the mismatch or an empty string if they agree.
+func (s *paymentService) orderAmountMismatch(payment *models.Payment) (string, error) {
+	order, err := s.orderClient.GetOrder(context.Background(), &proto.GetOrderRequest{
 		OrderId:    payment.OrderID.String(),
-		CustomerId: "payment_service",
-		Status:     status,
+		CustomerId: "admin",
 	})
 	if err != nil {
 		return "", err
 	}
-	return "Payment stored successfully", nil
-}
+	if !order.Success {
+		return "", orderLookupError(payment.OrderID.String(), order.Error)
+	}
 
-func (s *paymentService) RefundPayment(transactionId string) error {
-	payment, err := s.paymentRepo.GetPaymentByTransactionID(transactionId)
+	currency := s.cfg.DefaultCurrency
+	if order.Currency != nil && *order.Currency != "" {
+		currency = strings.ToLower(*order.Currency)
+	}
+
+	expected, err := orderTotal(order, currency)
 	if err != nil {
+		return "", err
+	}
+
+	if payment.Amount != expected {
+		return fmt.Sprintf("Reported amount %s does not match order total %s", payment.Amount, expected), nil
+	}
+
+	return "", nil
+}
+
+// orderTotal is what the order should cost: its items plus shipping, each
+// rounded to the currency's minor units as they are charged at checkout.
+func orderTotal(order *proto.GetOrderResponse, currency string) (money.Money, error) {
+	total := money.New(0, currency)
+
+	var err error
+	for _, item := range order.Items {
+		if total, err = total.Add(money.FromMajor(item.Price, currency).Mul(int64(item.Quantity))); err != nil {
+			return money.Money{}, errors.NewInternalError(err)
+		}
+	}
+
+	if order.ShippingCost > 0 {
+		if total, err = total.Add(money.FromMajor(order.ShippingCost, currency)); err != nil {
+			return money.Money{}, errors.NewInternalError(err)
+		}
+	}
+
+	return total, nil
+}
+
+// SyncPaymentIntent brings a manual capture payment in line with its
+// PaymentIntent at the provider, recording its authorization, a capture made
+// outside CapturePayment, or the authorization being canceled or expiring. The
+// provider's current state is used rather than an event's, since events for the
+// same PaymentIntent can arrive in any order. Payments captured automatically
+// are left alone.
+func (s *paymentService) SyncPaymentIntent(paymentIntentID string, actor models.Actor) error {
+	payment, err := s.paymentRepo.GetPaymentByTransactionID(paymentIntentID)
+	if err != nil && !isNotFoundError(err) {
 		return err
 	}
+	if err == nil && payment.CaptureMethod != models.CaptureMethodManual {
+		return nil
+	}
 
-	err = s.paymentRepo.UpdatePaymentStatus(payment.OrderID.String(), "refunded")
+	intent, getErr := s.provider.GetPaymentIntent(paymentIntentID)
+	if getErr != nil {
+		return getErr
+	}
+
+	if payment == nil {
+		if payment, err = s.paymentForIntent(intent, err); err != nil {
+			return err
+		}
+		if payment.CaptureMethod != models.CaptureMethodManual {
+			return nil
+		}
+	}
+
+	switch intent.Status {
+	case "requires_capture":
+		if payment.Status != models.PaymentStatusPending {
+			return nil
+		}
+		return s.authorizePayment(payment, intent, actor)
+	case "succeeded":
+		if payment.Status != models.PaymentStatusAuthorized {
+			return nil
+		}
+		return s.recordCapture(payment, intent, actor)
+	case "canceled":
+		if payment.Status != models.PaymentStatusAuthorized && payment.Status != models.PaymentStatusManualReview {
+			return nil
+		}
+
+		// The order can be paid again once its authorization is gone.
+		status, action, note := models.PaymentStatusVoided, models.PaymentActionVoided, "Authorization canceled at the payment provider"
+		if intent.CancellationReason == "automatic" {
+			status, action, note = models.PaymentStatusExpired, models.PaymentActionExpired, "Authorization expired before it was captured"
+		}
+		return s.paymentRepo.UpdatePaymentStatus(payment.ID.String(), status, actor.Change(action, note).NotifyOrder("payment_failed"))
+	default:
+		return nil
+	}
+}
+
+// paymentForIntent finds the pending payment of a PaymentIntent that is not yet
+// stored under its ID. Authorizations are usually reported before the checkout
+// completes, so the payment is found through the order's open checkout session
+// and its transaction ID replaced with the PaymentIntent ID. notFound is returned
+// if there is no such payment.
+func (s *paymentService) paymentForIntent(intent *providers.PaymentIntent, notFound error) (*models.Payment, error) {
+	orderID := intent.Metadata["order_id"]
+	if orderID == "" {
+		return nil, notFound
+	}
+
+	open, err := s.checkoutSessionRepo.GetOpenSessionByOrderID(orderID)
+	if isNotFoundError(err) {
+		return nil, notFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.provider.GetCheckoutSession(open.StripeSessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.PaymentIntentID != intent.ID {
+		return nil, notFound
+	}
+
+	payment, err := s.paymentRepo.GetPaymentByCheckoutSessionID(open.StripeSessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.paymentRepo.UpdateTransactionID(payment.ID.String(), intent.ID); err != nil {
+		return nil, err
+	}
+	payment.TransactionID = intent.ID
+	return payment, nil
+}
+
+// authorizePayment records the authorization of a pending manual capture payment
+// and tells the order service it can be verified. An authorization whose amount
+// does not match the order is held for review instead.
+func (s *paymentService) authorizePayment(payment *models.Payment, intent *providers.PaymentIntent, actor models.Actor) error {
+	mismatch, err := s.orderAmountMismatch(payment)
 	if err != nil {
 		return err
 	}
+	if mismatch == "" && intent.AmountCapturable != payment.Amount {
+		mismatch = fmt.Sprintf("Authorized amount %s does not match order total %s", intent.AmountCapturable, payment.Amount)
+	}
+
+	expiresAt := intent.CaptureBefore
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(authorizationWindow)
+	}
+
+	if mismatch != "" {
+		utils.Warn("Authorized amount mismatch, holding for manual review", map[string]interface{}{
+			"order_id":       payment.OrderID,
+			"transaction_id": payment.TransactionID,
+			"reason":         mismatch,
+		})
+		return s.paymentRepo.AuthorizePayment(payment.ID.String(), models.PaymentStatusManualReview, expiresAt, actor.Change(models.PaymentActionAuthorized, mismatch))
+	}
+
+	change := actor.Change(models.PaymentActionAuthorized, fmt.Sprintf("%s authorized until %s", intent.AmountCapturable, expiresAt.UTC().Format(time.RFC3339)))
+	return s.paymentRepo.AuthorizePayment(payment.ID.String(), models.PaymentStatusAuthorized, expiresAt, change.NotifyOrder("payment_authorized"))
+}
+
+// recordCapture marks an authorized payment as paid once the provider has
+// captured it, holding it for review if less than the payment amount was captured.
+func (s *paymentService) recordCapture(payment *models.Payment, intent *providers.PaymentIntent, actor models.Actor) error {
+	if intent.AmountReceived != payment.Amount {
+		mismatch := fmt.Sprintf("Captured amount %s does not match order total %s", intent.AmountReceived, payment.Amount)
+		utils.Warn("Captured amount mismatch, holding for manual review", map[string]interface{}{
+			"order_id":       payment.OrderID,
+			"transaction_id": payment.TransactionID,
+			"reason":         mismatch,
+		})
+		return s.paymentRepo.RecordCapture(payment.ID.String(), models.PaymentStatusManualReview, actor.Change(models.PaymentActionCaptured, mismatch))
+	}
+
+	change := actor.Change(models.PaymentActionCaptured, fmt.Sprintf("%s captured", intent.AmountReceived)).NotifyOrder("paid")
+	return s.paymentRepo.RecordCapture(payment.ID.String(), models.PaymentStatusSuccessful, change)
+}
+
+// CapturePayment captures the authorized payment of an order, once its
+// prescription has been verified.
+func (s *paymentService) CapturePayment(orderID string, actor models.Actor, idempotencyKey string) (*models.Payment, error) {
+	payment, err := s.paymentRepo.GetPaymentByOrderID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.Status != models.PaymentStatusAuthorized {
+		return nil, errors.NewConflictError(fmt.Sprintf("Payment for order '%s' is %s and cannot be captured", orderID, payment.Status))
+	}
+
+	if idempotencyKey != "" {
+		idempotencyKey = "capture:" + idempotencyKey
+	}
+	intent, err := s.provider.CapturePaymentIntent(payment.TransactionID, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.recordCapture(payment, intent, actor); err != nil {
+		return nil, err
+	}
+	return s.paymentRepo.GetPayment(payment.ID.String())
+}
 
-	_, err = s.orderClient.UpdateOrderStatus(context.Background(), &proto.UpdateOrderStatusRequest{
-		OrderId: payment.OrderID.String(),
-		Status:  "refunded",
+// VoidPayment releases the authorized payment of an order without capturing it,
+// when its prescription is rejected. Authorizations held for review can be
+// voided too. The order service made the decision, so it is not notified.
+func (s *paymentService) VoidPayment(orderID string, reason string, actor models.Actor, idempotencyKey string) (*models.Payment, error) {
+	payment, err := s.paymentRepo.GetPaymentByOrderID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	voidable := payment.Status == models.PaymentStatusAuthorized ||
+		(payment.Status == models.PaymentStatusManualReview && payment.CaptureMethod == models.CaptureMethodManual && payment.AuthorizationExpiresAt != nil)
+	if !voidable {
+		return nil, errors.NewConflictError(fmt.Sprintf("Payment for order '%s' is %s and cannot be voided", orderID, payment.Status))
+	}
+
+	if idempotencyKey != "" {
+		idempotencyKey = "void:" + idempotencyKey
+	}
+	if _, err := s.provider.CancelPaymentIntent(payment.TransactionID, idempotencyKey); err != nil {
+		return nil, err
+	}
+
+	note := "Authorization voided"
+	if reason != "" {
+		note = fmt.Sprintf("Authorization voided: %s", reason)
+	}
+	if err := s.paymentRepo.UpdatePaymentStatus(payment.ID.String(), models.PaymentStatusVoided, actor.Change(models.PaymentActionVoided, note)); err != nil {
+		return nil, err
+	}
+	return s.paymentRepo.GetPayment(payment.ID.String())
+}
+
+// ResolveManualReview releases a payment held for review once an operator has
+// checked it, marking it successful and the order paid. A payment that should
+// not stand is refunded instead, and an authorization that was never captured
+// is voided.
+func (s *paymentService) ResolveManualReview(paymentID string, note string, actor models.Actor) (*models.Payment, error) {
+	if strings.TrimSpace(note) == "" {
+		return nil, errors.NewValidationError("note", "Explain why the payment can be released")
+	}
+
+	payment, err := s.paymentRepo.GetPayment(paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.Status != models.PaymentStatusManualReview {
+		return nil, errors.NewConflictError(fmt.Sprintf("Payment '%s' is %s, not held for manual review", paymentID, payment.Status))
+	}
+	if payment.CaptureMethod == models.CaptureMethodManual && payment.AuthorizationExpiresAt != nil {
+		return nil, errors.NewConflictError(fmt.Sprintf("Payment '%s' is an uncaptured authorization and can only be voided", paymentID))
+	}
+
+	change := actor.Change(models.PaymentActionReviewResolved, note).NotifyOrder("paid")
+	if err := s.paymentRepo.UpdatePaymentStatus(payment.ID.String(), models.PaymentStatusSuccessful, change); err != nil {
+		return nil, err
+	}
+	return s.paymentRepo.GetPayment(payment.ID.String())
+}
+
+// RefundPayment issues a refund through the payment provider against the
+// payment's PaymentIntent. A zero amount refunds the remaining balance, and an
+// amount without a currency is taken to be in the payment's currency. Refunds
+// above the approval threshold are not issued; a pending approval is returned
+// instead, and the refund is issued once ApproveRefund approves it.
+func (s *paymentService) RefundPayment(transactionId string, amount money.Money, reason string, actor models.Actor, idempotencyKey string) (*models.Refund, *models.RefundApproval, error) {
+	payment, err := s.paymentRepo.GetPaymentByTransactionID(transactionId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkRefundable(payment); err != nil {
+		return nil, nil, err
+	}
+
+	if reason == "" {
+		reason = models.RefundReasonRequestedByCustomer
+	}
+	if !slices.Contains(models.RefundReasons, reason) {
+		return nil, nil, errors.NewValidationError("reason", fmt.Sprintf("Must be one of: %s", strings.Join(models.RefundReasons, ", ")))
+	}
+
+	if amount.IsNegative() {
+		return nil, nil, errors.NewValidationError("amount", "Must not be negative")
+	}
+
+	if amount.Currency == "" {
+		amount.Currency = payment.Amount.Currency
+	}
+	if !amount.SameCurrency(payment.Amount) {
+		return nil, nil, errors.NewValidationError("currency", fmt.Sprintf("Refund currency '%s' does not match payment currency '%s'", amount.Currency, payment.Amount.Currency))
+	}
+
+	refunds, err := s.refundRepo.ListRefundsByPaymentID(payment.ID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refunded := money.New(0, payment.Amount.Currency)
+	for _, existing := range refunds {
+		if !existing.IsOpen() {
+			continue
+		}
+		if refunded, err = refunded.Add(existing.Amount); err != nil {
+			return nil, nil, errors.NewInternalError(err)
+		}
+	}
+
+	if amount.IsZero() {
+		if amount, err = payment.Amount.Sub(refunded); err != nil {
+			return nil, nil, errors.NewInternalError(err)
+		}
+		if amount.Minor <= 0 {
+			return nil, nil, errors.NewConflictError(fmt.Sprintf("Payment with transaction ID '%s' has already been fully refunded", transactionId))
+		}
+	}
+
+	// Approval is decided on everything refunded or awaiting approval on the
+	// payment so far, so a large refund cannot be split into several small ones.
+	awaiting, err := s.refundsAwaitingApproval(payment, refunds)
+	if err != nil {
+		return nil, nil, err
+	}
+	committed, err := refunded.Add(awaiting)
+	if err != nil {
+		return nil, nil, errors.NewInternalError(err)
+	}
+	if s.needsRefundApproval(committed, amount) {
+		approval, err := s.requestRefundApproval(payment, amount, reason, actor)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, approval, nil
+	}
+
+	if idempotencyKey != "" {
+		idempotencyKey = "refund:" + idempotencyKey
+	}
+	refundRecord, err := s.issueRefund(payment, amount, reason, actor, idempotencyKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return refundRecord, nil, nil
+}
+
+// refundsAwaitingApproval sums the refunds of the payment that are still waiting
+// for approval. Approvals whose refund is already reserved are left out, as the
+// refund itself is counted among refunds.
+func (s *paymentService) refundsAwaitingApproval(payment *models.Payment, refunds []models.Refund) (money.Money, error) {
+	approvals, err := s.refundApprovalRepo.ListPendingApprovals(payment.ID.String())
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	awaiting := money.New(0, payment.Amount.Currency)
+	for _, approval := range approvals {
+		if approval.RefundID != nil && slices.ContainsFunc(refunds, func(refund models.Refund) bool {
+			return refund.ID == *approval.RefundID && refund.IsOpen()
+		}) {
+			continue
+		}
+		if awaiting, err = awaiting.Add(approval.Amount); err != nil {
+			return money.Money{}, errors.NewInternalError(err)
+		}
+	}
+	return awaiting, nil
+}
+
+// needsRefundApproval reports whether refunding amount on top of what was already
+// refunded or requested goes above the approval threshold of the currency. Refunds in a
+// currency without a threshold always need approval; a threshold of 0 turns
+// approval off.
+func (s *paymentService) needsRefundApproval(refunded money.Money, amount money.Money) bool {
+	threshold, ok := s.cfg.RefundApprovalThresholds[amount.Currency]
+	if !ok {
+		return true
+	}
+	return threshold > 0 && refunded.Minor+amount.Minor > threshold
+}
+
+// checkRefundable rejects refunds of payments that have not been paid or have
+// been charged back. Payments held for review can be refunded too, which is
+// usually how a mismatched payment is resolved.
+func checkRefundable(payment *models.Payment) error {
+	if payment.Status != models.PaymentStatusSuccessful && payment.Status != models.PaymentStatusPartiallyRefunded && payment.Status != models.PaymentStatusManualReview {
+		return errors.NewConflictError(fmt.Sprintf("Payment with transaction ID '%s' is %s and cannot be refunded", payment.TransactionID, payment.Status))
+	}
+	return nil
+}
+
+// requestRefundApproval records a refund that needs a second person's approval
+// before it is issued.
+func (s *paymentService) requestRefundApproval(payment *models.Payment, amount money.Money, reason string, actor models.Actor) (*models.RefundApproval, error) {
+	if actor.ID == "" || actor.ID == models.UnknownActorID {
+		return nil, errors.NewValidationError("actor", "Required for refunds that need approval")
+	}
+
+	approval := &models.RefundApproval{
+		PaymentID:   payment.ID,
+		Amount:      amount,
+		Reason:      reason,
+		Status:      models.RefundApprovalStatusPending,
+		RequestedBy: actor.ID,
+	}
+	if err := s.refundApprovalRepo.CreateApproval(approval); err != nil {
+		return nil, err
+	}
+
+	note := fmt.Sprintf("Refund of %s (%s) awaits approval %s", amount, reason, approval.ID)
+	if err := s.paymentRepo.RecordPaymentChange(payment.ID.String(), actor.Change(models.PaymentActionRefundApprovalRequested, note)); err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+// issueRefund reserves the refund in the ledger and issues it through the
+// provider. The refund is reserved before the provider is called, so the total
+// refunded can never exceed the payment amount.
+func (s *paymentService) issueRefund(payment *models.Payment, amount money.Money, reason string, actor models.Actor, idempotencyKey string) (*models.Refund, error) {
+	refundRecord := &models.Refund{
+		PaymentID: payment.ID,
+		Amount:    amount,
+		Reason:    reason,
+		Status:    models.RefundStatusPending,
+	}
+	if err := s.refundRepo.CreateRefund(refundRecord); err != nil {
+		return nil, err
+	}
+
+	if err := s.recordRefundRequested(payment, refundRecord, actor); err != nil {
+		return nil, err
+	}
+	if err := s.submitRefund(payment, refundRecord, actor, idempotencyKey); err != nil {
+		return nil, err
+	}
+	return refundRecord, nil
+}
+
+func (s *paymentService) recordRefundRequested(payment *models.Payment, refundRecord *models.Refund, actor models.Actor) error {
+	note := fmt.Sprintf("Refund %s of %s requested (%s)", refundRecord.ID, refundRecord.Amount, refundRecord.Reason)
+	return s.paymentRepo.RecordPaymentChange(payment.ID.String(), actor.Change(models.PaymentActionRefundRequested, note))
+}
+
+// submitRefund issues a reserved refund through the provider and records the
+// outcome on it. The payment is only marked refunded once the provider reports
+// the refund as succeeded; pending refunds are completed by the refund webhooks.
+func (s *paymentService) submitRefund(payment *models.Payment, refundRecord *models.Refund, actor models.Actor, idempotencyKey string) error {
+	providerRefund, err := s.provider.CreateRefund(providers.RefundRequest{
+		PaymentIntentID: payment.TransactionID,
+		Amount:          refundRecord.Amount,
+		Reason:          refundRecord.Reason,
+		Metadata: map[string]string{
+			"order_id":   payment.OrderID.String(),
+			"payment_id": payment.ID.String(),
+			"refund_id":  refundRecord.ID.String(),
+			"reason":     refundRecord.Reason,
+		},
+		IdempotencyKey: idempotencyKey,
 	})
 	if err != nil {
+		refundRecord.Status = models.RefundStatusFailed
+		refundRecord.FailureReason = err.Error()
+		if updateErr := s.refundRepo.UpdateRefund(refundRecord); updateErr != nil {
+			return updateErr
+		}
 		return err
 	}
+
+	refundRecord.StripeRefundID = providerRefund.ID
+	refundRecord.Status = providerRefund.Status
+	refundRecord.FailureReason = providerRefund.FailureReason
+	if err := s.refundRepo.UpdateRefund(refundRecord); err != nil {
+		return err
+	}
+
+	switch providerRefund.Status {
+	case models.RefundStatusSucceeded:
+		if err := s.syncRefundedStatus(payment, actor); err != nil {
+			return err
+		}
+	case models.RefundStatusFailed, models.RefundStatusCanceled:
+		return errors.NewBadRequestError(fmt.Sprintf("Refund %s was %s", providerRefund.ID, providerRefund.Status))
+	}
+
 	return nil
 }
 
+// ApproveRefund approves a pending refund approval and issues its refund. The
+// approver must be one of the configured refund approvers and must not be who
+// requested the refund. The refund is reserved under the approval's lock and
+// issued before the approval is marked approved, so a refund that fails leaves
+// the approval pending to be approved again. The refund is issued with an
+// idempotency key derived from the approval, so a retried approval never issues
+// it twice.
+func (s *paymentService) ApproveRefund(approvalID string, approver models.Actor, comment string) (*models.RefundApproval, *models.Refund, error) {
+	approval, err := s.pendingRefundApproval(approvalID, approver)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payment, err := s.paymentRepo.GetPayment(approval.PaymentID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkRefundable(payment); err != nil {
+		return nil, nil, err
+	}
+
+	refundRecord, created, err := s.refundApprovalRepo.ReserveRefund(approvalID, &models.Refund{
+		PaymentID: payment.ID,
+		Amount:    approval.Amount,
+		Reason:    approval.Reason,
+		Status:    models.RefundStatusPending,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if created {
+		if err := s.recordRefundRequested(payment, refundRecord, approver); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// A refund reserved by an approval that was interrupted has not reached the
+	// provider yet; it is submitted again with the same key.
+	if refundRecord.StripeRefundID == "" {
+		idempotencyKey := fmt.Sprintf("refund-approval:%s:%s", approval.ID, refundRecord.ID)
+		if err := s.submitRefund(payment, refundRecord, approver, idempotencyKey); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := s.refundApprovalRepo.DecideApproval(approvalID, models.RefundApprovalStatusApproved, approver.ID, comment); err != nil {
+		// Another approver issued the same refund in the meantime.
+		decided, getErr := s.refundApprovalRepo.GetApproval(approvalID)
+		if getErr != nil || decided.Status != models.RefundApprovalStatusApproved || decided.RefundID == nil || *decided.RefundID != refundRecord.ID {
+			return nil, nil, err
+		}
+		return decided, refundRecord, nil
+	}
+
+	note := fmt.Sprintf("Refund approval %s of %s approved", approval.ID, approval.Amount)
+	if comment != "" {
+		note = fmt.Sprintf("%s: %s", note, comment)
+	}
+	if err := s.paymentRepo.RecordPaymentChange(payment.ID.String(), approver.Change(models.PaymentActionRefundApproved, note)); err != nil {
+		return nil, nil, err
+	}
+
+	approval, err = s.refundApprovalRepo.GetApproval(approvalID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return approval, refundRecord, nil
+}
+
+// RejectRefund rejects a pending refund approval, so its refund is never issued.
+// It is held to the same rules as ApproveRefund, and an approval whose refund is
+// already being issued cannot be rejected.
+func (s *paymentService) RejectRefund(approvalID string, approver models.Actor, comment string) (*models.RefundApproval, error) {
+	approval, err := s.pendingRefundApproval(approvalID, approver)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.refundApprovalRepo.DecideApproval(approvalID, models.RefundApprovalStatusRejected, approver.ID, comment); err != nil {
+		return nil, err
+	}
+
+	note := fmt.Sprintf("Refund approval %s of %s rejected", approval.ID, approval.Amount)
+	if comment != "" {
+		note = fmt.Sprintf("%s: %s", note, comment)
+	}
+	if err := s.paymentRepo.RecordPaymentChange(approval.PaymentID.String(), approver.Change(models.PaymentActionRefundRejected, note)); err != nil {
+		return nil, err
+	}
+
+	return s.refundApprovalRepo.GetApproval(approvalID)
+}
+
+// pendingRefundApproval returns the approval if it is still pending and the
+// actor may decide on it: they must be one of the configured refund approvers
+// and must not be the person who requested the refund, both compared ignoring
+// case. The actor itself is asserted by the caller; only the allowlist of
+// approvers is configured on the service.
+func (s *paymentService) pendingRefundApproval(approvalID string, approver models.Actor) (*models.RefundApproval, error) {
+	if approver.ID == "" || approver.ID == models.UnknownActorID {
+		return nil, errors.NewValidationError("actor", "Required to approve or reject a refund")
+	}
+	if !s.isRefundApprover(approver.ID) {
+		return nil, errors.NewAuthError(fmt.Sprintf("'%s' is not allowed to approve or reject refunds", approver.ID))
+	}
+
+	approval, err := s.refundApprovalRepo.GetApproval(approvalID)
+	if err != nil {
+		return nil, err
+	}
+	if approval.Status != models.RefundApprovalStatusPending {
+		return nil, errors.NewConflictError(fmt.Sprintf("Refund approval '%s' has already been %s", approvalID, approval.Status))
+	}
+	if strings.EqualFold(approval.RequestedBy, approver.ID) {
+		return nil, errors.NewAuthError("A refund must be approved or rejected by someone other than its requester")
+	}
+
+	return approval, nil
+}
+
+func (s *paymentService) isRefundApprover(actorID string) bool {
+	return slices.ContainsFunc(s.cfg.RefundApprovers, func(approver string) bool {
+		return strings.EqualFold(approver, actorID)
+	})
+}
+
+// SyncRefund records the provider's current state of a refund in the ledger.
+// Refund events can arrive out of order, so the refund is fetched rather than
+// taken from the event, which would let a late refund.created move a succeeded
+// refund back to pending. Refunds created by RefundPayment carry our ledger ID
+// in their metadata.
+func (s *paymentService) SyncRefund(stripeRefundID string, actor models.Actor) error {
+	providerRefund, err := s.provider.GetRefund(stripeRefundID)
+	if err != nil {
+		return err
+	}
+	if providerRefund.PaymentIntentID == "" {
+		return nil
+	}
+
+	update := &models.Refund{
+		StripeRefundID: providerRefund.ID,
+		Amount:         providerRefund.Amount,
+		Reason:         providerRefund.Metadata["reason"],
+		Status:         providerRefund.Status,
+		FailureReason:  providerRefund.FailureReason,
+	}
+	if refundId, err := uuid.Parse(providerRefund.Metadata["refund_id"]); err == nil {
+		update.ID = refundId
+	}
+
+	return s.updateRefundStatus(providerRefund.PaymentIntentID, update, actor)
+}
+
+// updateRefundStatus records the latest Stripe status of a refund in the ledger.
+// Refunds we did not initiate, such as those issued from the Stripe dashboard,
+// are added to the ledger as they are reported.
+func (s *paymentService) updateRefundStatus(transactionId string, update *models.Refund, actor models.Actor) error {
+	refundRecord, err := s.refundRepo.GetRefundByStripeID(update.StripeRefundID)
+	if isNotFoundError(err) && update.ID != uuid.Nil {
+		// The webhook can arrive before RefundPayment has saved the Stripe ID.
+		refundRecord, err = s.refundRepo.GetRefund(update.ID.String())
+	}
+
+	var payment *models.Payment
+	switch {
+	case err == nil:
+		refundRecord.StripeRefundID = update.StripeRefundID
+		refundRecord.Status = update.Status
+		refundRecord.FailureReason = update.FailureReason
+		if err := s.refundRepo.UpdateRefund(refundRecord); err != nil {
+			return err
+		}
+
+		payment, err = s.paymentRepo.GetPayment(refundRecord.PaymentID.String())
+		if err != nil {
+			return err
+		}
+	case isNotFoundError(err):
+		payment, err = s.paymentRepo.GetPaymentByTransactionID(transactionId)
+		if err != nil {
+			return err
+		}
+
+		if update.Reason == "" {
+			update.Reason = models.RefundReasonOther
+		}
+		if err := s.refundRepo.RecordRefund(&models.Refund{
+			PaymentID:      payment.ID,
+			StripeRefundID: update.StripeRefundID,
+			Amount:         update.Amount,
+			Reason:         update.Reason,
+			Status:         update.Status,
+			FailureReason:  update.FailureReason,
+		}); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	return s.syncRefundedStatus(payment, actor)
+}
+
+// SyncRefundedStatus brings the payment's status in line with its succeeded
+// refunds, for instance once a dispute that held it has been won.
+func (s *paymentService) SyncRefundedStatus(paymentID string, actor models.Actor) error {
+	payment, err := s.paymentRepo.GetPayment(paymentID)
+	if err != nil {
+		return err
+	}
+	return s.syncRefundedStatus(payment, actor)
+}
+
+// syncRefundedStatus moves the payment to partially_refunded or refunded based on
+// its succeeded refunds, and queues a notification to the order service once it
+// is fully refunded.
+func (s *paymentService) syncRefundedStatus(payment *models.Payment, actor models.Actor) error {
+	refunds, err := s.refundRepo.ListRefundsByPaymentID(payment.ID.String())
+	if err != nil {
+		return err
+	}
+
+	refunded := money.New(0, payment.Amount.Currency)
+	for _, existing := range refunds {
+		if existing.Status != models.RefundStatusSucceeded {
+			continue
+		}
+		if refunded, err = refunded.Add(existing.Amount); err != nil {
+			return errors.NewInternalError(err)
+		}
+	}
+
+	// A disputed payment keeps its status until the dispute is decided.
+	if payment.Status == models.PaymentStatusDisputed {
+		return nil
+	}
+
+	status := payment.Status
+	switch {
+	case refunded.Minor >= payment.Amount.Minor:
+		status = models.PaymentStatusRefunded
+	case refunded.Minor > 0:
+		status = models.PaymentStatusPartiallyRefunded
+	}
+
+	if status == payment.Status {
+		return nil
+	}
+
+	change := actor.Change(models.PaymentActionRefunded, fmt.Sprintf("%s of %s refunded", refunded, payment.Amount))
+	if status == models.PaymentStatusRefunded {
+		change = change.NotifyOrder("refunded")
+	}
+
+	return s.paymentRepo.UpdatePaymentStatus(payment.ID.String(), status, change)
+}
+
 func (s *paymentService) GetPaymentByTransactionID(transactionID string) (*models.Payment, error) {
 	payment, err := s.paymentRepo.GetPaymentByTransactionID(transactionID)
 	if err != nil {
@@ -165,3 +1363,57 @@ func (s *paymentService) GetPaymentByOrderID(orderID string) (*models.Payment, e
 	}
 	return payment, nil
 }
+
+func (s *paymentService) ListPaymentAttempts(orderID string) ([]models.Payment, error) {
+	payments, err := s.paymentRepo.ListPaymentsByOrderID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("No payments found for order ID '%s'", orderID))
+	}
+	return payments, nil
+}
+
+func (s *paymentService) GetPaymentTimeline(orderID string) ([]models.PaymentStatusChange, error) {
+	changes, err := s.paymentRepo.GetPaymentTimeline(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("No payment history found for order ID '%s'", orderID))
+	}
+	return changes, nil
+}
+
+// orderLookupError converts an error reported by the order service for GetOrder.
+func orderLookupError(orderID string, orderErr *proto.Error) error {
+	if orderErr == nil {
+		return errors.NewBadRequestError(fmt.Sprintf("Order '%s' could not be loaded", orderID))
+	}
+
+	switch errors.ErrorType(orderErr.Type) {
+	case errors.AuthError:
+		return errors.NewAuthError(orderErr.Message)
+	case errors.NotFoundError:
+		return errors.NewNotFoundError(orderErr.Message)
+	default:
+		return errors.NewBadRequestError(fmt.Sprintf("Order '%s' could not be loaded: %s", orderID, orderErr.Message))
+	}
+}
+
+// isPrescriptionOrder reports whether the order carries a prescription or has
+// items that need one.
+func isPrescriptionOrder(order *proto.GetOrderResponse) bool {
+	if order.PrescriptionUrl != nil && *order.PrescriptionUrl != "" {
+		return true
+	}
+	return slices.ContainsFunc(order.Items, func(item *proto.OrderItem) bool {
+		return item.RequiresPrescription
+	})
+}
+
+func isNotFoundError(err error) bool {
+	appErr, ok := errors.IsAppError(err)
+	return ok && appErr.Type == errors.NotFoundError
+}
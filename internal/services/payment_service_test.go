@@ -0,0 +1,845 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/policies"
+	"github.com/PharmaKart/payment-svc/internal/proto"
+	"github.com/PharmaKart/payment-svc/internal/providers"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+)
+
+func TestMain(m *testing.M) {
+	utils.InitLogger()
+	utils.Logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// memoryPaymentRepository keeps payments in memory and applies the same
+// transition rules as the database repository.
+type memoryPaymentRepository struct {
+	mu       sync.Mutex
+	payments map[uuid.UUID]*models.Payment
+	history  []models.PaymentStatusChange
+}
+
+func newMemoryPaymentRepository() *memoryPaymentRepository {
+	return &memoryPaymentRepository{payments: map[uuid.UUID]*models.Payment{}}
+}
+
+func (r *memoryPaymentRepository) find(match func(*models.Payment) bool, what string) (*models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var found *models.Payment
+	for _, payment := range r.payments {
+		if match(payment) && (found == nil || payment.CreatedAt.After(found.CreatedAt)) {
+			found = payment
+		}
+	}
+	if found == nil {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Payment with %s not found", what))
+	}
+	copied := *found
+	return &copied, nil
+}
+
+func (r *memoryPaymentRepository) record(payment *models.Payment, change models.PaymentStatusChange) {
+	change.PaymentID = payment.ID
+	r.history = append(r.history, change)
+}
+
+func (r *memoryPaymentRepository) StorePayment(payment *models.Payment, change models.PaymentStatusChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.payments {
+		if existing.TransactionID == payment.TransactionID {
+			return errors.NewConflictError(fmt.Sprintf("Transaction '%s' is already stored", payment.TransactionID))
+		}
+	}
+
+	payment.ID = uuid.New()
+	payment.CreatedAt = time.Now()
+	if payment.CaptureMethod == "" {
+		payment.CaptureMethod = models.CaptureMethodAutomatic
+	}
+	stored := *payment
+	r.payments[payment.ID] = &stored
+
+	change.ToStatus = payment.Status
+	r.record(payment, change)
+	return nil
+}
+
+func (r *memoryPaymentRepository) GetPaymentByOrderID(orderID string) (*models.Payment, error) {
+	return r.find(func(p *models.Payment) bool { return p.OrderID.String() == orderID }, "order ID "+orderID)
+}
+
+func (r *memoryPaymentRepository) ListPaymentsByOrderID(orderID string) ([]models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var payments []models.Payment
+	for _, payment := range r.payments {
+		if payment.OrderID.String() == orderID {
+			payments = append(payments, *payment)
+		}
+	}
+	return payments, nil
+}
+
+func (r *memoryPaymentRepository) GetPaymentByTransactionID(transactionID string) (*models.Payment, error) {
+	return r.find(func(p *models.Payment) bool { return p.TransactionID == transactionID }, "transaction ID "+transactionID)
+}
+
+func (r *memoryPaymentRepository) GetPaymentByCheckoutSessionID(checkoutSessionID string) (*models.Payment, error) {
+	return r.find(func(p *models.Payment) bool { return p.CheckoutSessionID == checkoutSessionID }, "checkout session ID "+checkoutSessionID)
+}
+
+func (r *memoryPaymentRepository) UpdateTransactionID(paymentID string, transactionID string) error {
+	return r.update(paymentID, func(p *models.Payment) error {
+		p.TransactionID = transactionID
+		return nil
+	})
+}
+
+func (r *memoryPaymentRepository) GetPayment(paymentID string) (*models.Payment, error) {
+	return r.find(func(p *models.Payment) bool { return p.ID.String() == paymentID }, "ID "+paymentID)
+}
+
+func (r *memoryPaymentRepository) update(paymentID string, apply func(*models.Payment) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, payment := range r.payments {
+		if payment.ID.String() == paymentID {
+			return apply(payment)
+		}
+	}
+	return errors.NewNotFoundError(fmt.Sprintf("Payment with ID '%s' not found", paymentID))
+}
+
+func (r *memoryPaymentRepository) transition(paymentID string, status string, apply func(*models.Payment), change models.PaymentStatusChange) error {
+	return r.update(paymentID, func(p *models.Payment) error {
+		if p.Status != status && !models.CanTransitionPayment(p.Status, status) {
+			return errors.NewConflictError(fmt.Sprintf("Payment cannot move from %s to %s", p.Status, status))
+		}
+		change.FromStatus = p.Status
+		change.ToStatus = status
+		p.Status = status
+		apply(p)
+		r.record(p, change)
+		return nil
+	})
+}
+
+func (r *memoryPaymentRepository) UpdatePaymentStatus(paymentID string, status string, change models.PaymentStatusChange) error {
+	return r.transition(paymentID, status, func(*models.Payment) {}, change)
+}
+
+func (r *memoryPaymentRepository) AuthorizePayment(paymentID string, status string, expiresAt time.Time, change models.PaymentStatusChange) error {
+	return r.transition(paymentID, status, func(p *models.Payment) { p.AuthorizationExpiresAt = &expiresAt }, change)
+}
+
+func (r *memoryPaymentRepository) RecordCapture(paymentID string, status string, change models.PaymentStatusChange) error {
+	return r.transition(paymentID, status, func(p *models.Payment) { p.AuthorizationExpiresAt = nil }, change)
+}
+
+func (r *memoryPaymentRepository) ListExpiringAuthorizations(before time.Time, limit int) ([]models.Payment, error) {
+	return nil, nil
+}
+
+func (r *memoryPaymentRepository) MarkAuthorizationAlerted(paymentID string, alertedAt time.Time) error {
+	return r.update(paymentID, func(p *models.Payment) error {
+		p.AuthorizationAlertedAt = &alertedAt
+		return nil
+	})
+}
+
+func (r *memoryPaymentRepository) ListStalePendingPayments(afterCreatedAt time.Time, afterID uuid.UUID, createdBefore time.Time, limit int) ([]models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var payments []models.Payment
+	for _, payment := range r.payments {
+		after := payment.CreatedAt.After(afterCreatedAt) || payment.CreatedAt.Equal(afterCreatedAt) && payment.ID.String() > afterID.String()
+		if payment.Status == models.PaymentStatusPending && after && payment.CreatedAt.Before(createdBefore) {
+			payments = append(payments, *payment)
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		if !payments[i].CreatedAt.Equal(payments[j].CreatedAt) {
+			return payments[i].CreatedAt.Before(payments[j].CreatedAt)
+		}
+		return payments[i].ID.String() < payments[j].ID.String()
+	})
+	if len(payments) > limit {
+		payments = payments[:limit]
+	}
+	return payments, nil
+}
+
+func (r *memoryPaymentRepository) RecordPaymentChange(paymentID string, change models.PaymentStatusChange) error {
+	return r.update(paymentID, func(p *models.Payment) error {
+		change.FromStatus = p.Status
+		change.ToStatus = p.Status
+		r.record(p, change)
+		return nil
+	})
+}
+
+func (r *memoryPaymentRepository) GetPaymentTimeline(orderID string) ([]models.PaymentStatusChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var timeline []models.PaymentStatusChange
+	for _, change := range r.history {
+		if r.payments[change.PaymentID].OrderID.String() == orderID {
+			timeline = append(timeline, change)
+		}
+	}
+	return timeline, nil
+}
+
+type memoryCheckoutSessionRepository struct {
+	mu       sync.Mutex
+	sessions map[string]*models.CheckoutSession
+}
+
+func newMemoryCheckoutSessionRepository() *memoryCheckoutSessionRepository {
+	return &memoryCheckoutSessionRepository{sessions: map[string]*models.CheckoutSession{}}
+}
+
+func (r *memoryCheckoutSessionRepository) CreateSession(session *models.CheckoutSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.sessions {
+		if existing.OrderID == session.OrderID && existing.Status == models.CheckoutSessionStatusOpen {
+			return errors.NewConflictError(fmt.Sprintf("Order '%s' already has an open checkout session", session.OrderID))
+		}
+	}
+	session.ID = uuid.New()
+	stored := *session
+	r.sessions[session.StripeSessionID] = &stored
+	return nil
+}
+
+func (r *memoryCheckoutSessionRepository) GetOpenSessionByOrderID(orderID string) (*models.CheckoutSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, session := range r.sessions {
+		if session.OrderID.String() == orderID && session.Status == models.CheckoutSessionStatusOpen {
+			copied := *session
+			return &copied, nil
+		}
+	}
+	return nil, errors.NewNotFoundError(fmt.Sprintf("Open checkout session for order '%s' not found", orderID))
+}
+
+func (r *memoryCheckoutSessionRepository) UpdateSessionStatus(stripeSessionID string, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[stripeSessionID]
+	if !ok {
+		return errors.NewNotFoundError(fmt.Sprintf("Checkout session '%s' not found", stripeSessionID))
+	}
+	session.Status = status
+	return nil
+}
+
+type memoryRefundRepository struct {
+	mu       sync.Mutex
+	payments *memoryPaymentRepository
+	refunds  []*models.Refund
+}
+
+func (r *memoryRefundRepository) CreateRefund(refund *models.Refund) error {
+	payment, err := r.payments.GetPayment(refund.PaymentID.String())
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	refunded := int64(0)
+	for _, existing := range r.refunds {
+		if existing.PaymentID == refund.PaymentID && existing.IsOpen() {
+			refunded += existing.Amount.Minor
+		}
+	}
+	if refund.Amount.Minor > payment.Amount.Minor-refunded {
+		return errors.NewValidationError("amount", "Refund exceeds the refundable balance")
+	}
+
+	return r.record(refund)
+}
+
+func (r *memoryRefundRepository) RecordRefund(refund *models.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.record(refund)
+}
+
+func (r *memoryRefundRepository) record(refund *models.Refund) error {
+	refund.ID = uuid.New()
+	refund.CreatedAt = time.Now()
+	stored := *refund
+	r.refunds = append(r.refunds, &stored)
+	return nil
+}
+
+func (r *memoryRefundRepository) find(match func(*models.Refund) bool, what string) (*models.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, refund := range r.refunds {
+		if match(refund) {
+			copied := *refund
+			return &copied, nil
+		}
+	}
+	return nil, errors.NewNotFoundError(fmt.Sprintf("Refund with %s not found", what))
+}
+
+func (r *memoryRefundRepository) GetRefund(refundID string) (*models.Refund, error) {
+	return r.find(func(refund *models.Refund) bool { return refund.ID.String() == refundID }, "ID "+refundID)
+}
+
+func (r *memoryRefundRepository) GetRefundByStripeID(stripeRefundID string) (*models.Refund, error) {
+	return r.find(func(refund *models.Refund) bool { return refund.StripeRefundID == stripeRefundID }, "Stripe ID "+stripeRefundID)
+}
+
+func (r *memoryRefundRepository) UpdateRefund(refund *models.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.refunds {
+		if existing.ID == refund.ID {
+			existing.StripeRefundID = refund.StripeRefundID
+			existing.Status = refund.Status
+			existing.FailureReason = refund.FailureReason
+			return nil
+		}
+	}
+	return errors.NewNotFoundError(fmt.Sprintf("Refund with ID '%s' not found", refund.ID))
+}
+
+func (r *memoryRefundRepository) ListRefundsByPaymentID(paymentID string) ([]models.Refund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var refunds []models.Refund
+	for _, refund := range r.refunds {
+		if refund.PaymentID.String() == paymentID {
+			refunds = append(refunds, *refund)
+		}
+	}
+	return refunds, nil
+}
+
+type memoryRefundApprovalRepository struct {
+	mu        sync.Mutex
+	refunds   *memoryRefundRepository
+	approvals map[string]*models.RefundApproval
+}
+
+func (r *memoryRefundApprovalRepository) CreateApproval(approval *models.RefundApproval) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	approval.ID = uuid.New()
+	stored := *approval
+	r.approvals[approval.ID.String()] = &stored
+	return nil
+}
+
+func (r *memoryRefundApprovalRepository) GetApproval(approvalID string) (*models.RefundApproval, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	approval, ok := r.approvals[approvalID]
+	if !ok {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Refund approval with ID '%s' not found", approvalID))
+	}
+	copied := *approval
+	return &copied, nil
+}
+
+func (r *memoryRefundApprovalRepository) ListPendingApprovals(paymentID string) ([]models.RefundApproval, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var approvals []models.RefundApproval
+	for _, approval := range r.approvals {
+		if approval.PaymentID.String() == paymentID && approval.Status == models.RefundApprovalStatusPending {
+			approvals = append(approvals, *approval)
+		}
+	}
+	return approvals, nil
+}
+
+// openRefund returns the approval's refund unless it has none or it failed.
+func (r *memoryRefundApprovalRepository) openRefund(approval *models.RefundApproval) *models.Refund {
+	if approval.RefundID == nil {
+		return nil
+	}
+	refund, err := r.refunds.GetRefund(approval.RefundID.String())
+	if err != nil || !refund.IsOpen() {
+		return nil
+	}
+	return refund
+}
+
+func (r *memoryRefundApprovalRepository) DecideApproval(approvalID string, status string, decidedBy string, comment string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	approval, ok := r.approvals[approvalID]
+	if !ok || approval.Status != models.RefundApprovalStatusPending || (status == models.RefundApprovalStatusRejected && r.openRefund(approval) != nil) {
+		return errors.NewConflictError(fmt.Sprintf("Refund approval '%s' has already been decided or its refund is being issued", approvalID))
+	}
+
+	now := time.Now()
+	approval.Status = status
+	approval.DecidedBy = decidedBy
+	approval.DecidedAt = &now
+	approval.Comment = comment
+	return nil
+}
+
+func (r *memoryRefundApprovalRepository) ReserveRefund(approvalID string, refund *models.Refund) (*models.Refund, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	approval, ok := r.approvals[approvalID]
+	if !ok {
+		return nil, false, errors.NewNotFoundError(fmt.Sprintf("Refund approval with ID '%s' not found", approvalID))
+	}
+	if approval.Status != models.RefundApprovalStatusPending {
+		return nil, false, errors.NewConflictError(fmt.Sprintf("Refund approval '%s' has already been %s", approvalID, approval.Status))
+	}
+	if existing := r.openRefund(approval); existing != nil {
+		return existing, false, nil
+	}
+
+	if err := r.refunds.CreateRefund(refund); err != nil {
+		return nil, false, err
+	}
+	refundID := refund.ID
+	approval.RefundID = &refundID
+	return refund, true, nil
+}
+
+// refundRecordingProvider records the idempotency key of every refund and fails
+// as many refunds as asked before handing them to the fake provider.
+type refundRecordingProvider struct {
+	*providers.FakeProvider
+	failures int
+	keys     []string
+}
+
+func (p *refundRecordingProvider) CreateRefund(req providers.RefundRequest) (*providers.Refund, error) {
+	p.keys = append(p.keys, req.IdempotencyKey)
+	if p.failures > 0 {
+		p.failures--
+		return nil, fmt.Errorf("connection reset")
+	}
+	return p.FakeProvider.CreateRefund(req)
+}
+
+// stubOrderClient answers GetOrder with a fixed order; the service uses no other
+// order service calls.
+type stubOrderClient struct {
+	proto.OrderServiceClient
+	order *proto.GetOrderResponse
+}
+
+func (c *stubOrderClient) GetOrder(ctx context.Context, in *proto.GetOrderRequest, opts ...grpc.CallOption) (*proto.GetOrderResponse, error) {
+	if in.OrderId != c.order.OrderId {
+		return &proto.GetOrderResponse{Success: false, Error: &proto.Error{Type: string(errors.NotFoundError), Message: "Order not found"}}, nil
+	}
+	return c.order, nil
+}
+
+type paymentServiceFixture struct {
+	service   PaymentService
+	cfg       *config.Config
+	provider  *providers.FakeProvider
+	refunding *refundRecordingProvider
+	payments  *memoryPaymentRepository
+	refunds   *memoryRefundRepository
+	approvals *memoryRefundApprovalRepository
+	sessions  *memoryCheckoutSessionRepository
+	order     *proto.GetOrderResponse
+}
+
+func newPaymentServiceFixture(t *testing.T, outcome string) *paymentServiceFixture {
+	t.Helper()
+
+	provider, err := providers.NewFakeProvider(outcome)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := &proto.GetOrderResponse{
+		Success:    true,
+		OrderId:    uuid.NewString(),
+		CustomerId: uuid.NewString(),
+		Status:     "pending",
+		Items: []*proto.OrderItem{
+			{ProductId: "vitamin-d", ProductName: "Vitamin D", Quantity: 2, Price: 12.50},
+		},
+		ShippingCost: 4.99,
+	}
+
+	cfg := &config.Config{
+		DefaultCurrency:          "cad",
+		SupportedCurrencies:      []string{"cad", "usd"},
+		PayableOrderStatuses:     []string{"pending", "payment_failed"},
+		RefundApprovalThresholds: map[string]int64{"cad": 2000, "usd": 2000},
+		RefundApprovers:          []string{"finance-lead", "finance-manager"},
+	}
+
+	payments := newMemoryPaymentRepository()
+	refunds := &memoryRefundRepository{payments: payments}
+	approvals := &memoryRefundApprovalRepository{refunds: refunds, approvals: map[string]*models.RefundApproval{}}
+	sessions := newMemoryCheckoutSessionRepository()
+	refunding := &refundRecordingProvider{FakeProvider: provider}
+	var orderClient proto.OrderServiceClient = &stubOrderClient{order: order}
+
+	return &paymentServiceFixture{
+		service:   NewPaymentService(payments, refunds, approvals, sessions, &orderClient, refunding, policies.NewPrescriptionPolicy(policies.DefaultPrescriptionRules()), cfg),
+		cfg:       cfg,
+		provider:  provider,
+		refunding: refunding,
+		payments:  payments,
+		refunds:   refunds,
+		approvals: approvals,
+		sessions:  sessions,
+		order:     order,
+	}
+}
+
+var _ repositories.PaymentRepository = (*memoryPaymentRepository)(nil)
+var _ repositories.CheckoutSessionRepository = (*memoryCheckoutSessionRepository)(nil)
+var _ repositories.RefundRepository = (*memoryRefundRepository)(nil)
+var _ repositories.RefundApprovalRepository = (*memoryRefundApprovalRepository)(nil)
+
+func TestFakeCheckoutIsSettledByReconcileCheckoutSession(t *testing.T) {
+	tests := []struct {
+		outcome       string
+		sessionStatus string
+		paymentStatus string
+		notifyOrder   string
+	}{
+		{providers.FakeOutcomeSuccess, models.CheckoutSessionStatusComplete, models.PaymentStatusSuccessful, "paid"},
+		// A declined card leaves the session open for another attempt, as Stripe
+		// does, so the payment stays pending until the session expires.
+		{providers.FakeOutcomeDecline, models.CheckoutSessionStatusOpen, models.PaymentStatusPending, ""},
+		// An asynchronous payment method has not settled yet.
+		{providers.FakeOutcomeAsync, models.CheckoutSessionStatusComplete, models.PaymentStatusPending, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.outcome, func(t *testing.T) {
+			f := newPaymentServiceFixture(t, tt.outcome)
+
+			checkout, err := f.service.GeneratePaymentURL(f.order.OrderId, f.order.CustomerId, "")
+			if err != nil {
+				t.Fatalf("GeneratePaymentURL: %v", err)
+			}
+
+			if _, err := f.provider.CompleteCheckoutSession(checkout.SessionID); err != nil {
+				t.Fatalf("CompleteCheckoutSession: %v", err)
+			}
+
+			actor := models.Actor{ID: "test", Source: models.ChangeSourceWebhook}
+			payment, err := f.service.ReconcileCheckoutSession(checkout.SessionID, actor)
+			if err != nil {
+				t.Fatalf("ReconcileCheckoutSession: %v", err)
+			}
+			if payment.ID.String() != checkout.PaymentID {
+				t.Errorf("settled payment %s, want %s", payment.ID, checkout.PaymentID)
+			}
+			if payment.Status != tt.paymentStatus {
+				t.Errorf("payment status = %q, want %q", payment.Status, tt.paymentStatus)
+			}
+			if got := f.sessions.sessions[checkout.SessionID].Status; got != tt.sessionStatus {
+				t.Errorf("stored session status = %q, want %q", got, tt.sessionStatus)
+			}
+
+			timeline, _ := f.payments.GetPaymentTimeline(f.order.OrderId)
+			last := timeline[len(timeline)-1]
+			if last.OrderStatus != tt.notifyOrder {
+				t.Errorf("order notified of %q, want %q", last.OrderStatus, tt.notifyOrder)
+			}
+
+			// Settling the same session again changes nothing.
+			again, err := f.service.ReconcileCheckoutSession(checkout.SessionID, actor)
+			if err != nil {
+				t.Fatalf("ReconcileCheckoutSession again: %v", err)
+			}
+			if again.Status != payment.Status {
+				t.Errorf("payment status after settling again = %q, want %q", again.Status, payment.Status)
+			}
+		})
+	}
+}
+
+func TestReconcileCheckoutSessionUnknownSession(t *testing.T) {
+	f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+
+	_, err := f.service.ReconcileCheckoutSession("cs_fake_missing", models.Actor{ID: "test", Source: models.ChangeSourceWebhook})
+	if !isNotFoundError(err) {
+		t.Errorf("ReconcileCheckoutSession of an unknown session = %v, want not found", err)
+	}
+}
+
+func TestPrescriptionOrdersAreOnlyAuthorizedAtCheckout(t *testing.T) {
+	f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+	prescriptionURL, prescriptionStatus := "https://rx.test/1", "approved"
+	f.order.Items[0].RequiresPrescription = true
+	f.order.PrescriptionUrl = &prescriptionURL
+	f.order.PrescriptionStatus = &prescriptionStatus
+
+	checkout, err := f.service.GeneratePaymentURL(f.order.OrderId, f.order.CustomerId, "")
+	if err != nil {
+		t.Fatalf("GeneratePaymentURL: %v", err)
+	}
+	if got := f.sessions.sessions[checkout.SessionID].CaptureMethod; got != models.CaptureMethodManual {
+		t.Errorf("session capture method = %q, want manual", got)
+	}
+
+	if _, err := f.provider.CompleteCheckoutSession(checkout.SessionID); err != nil {
+		t.Fatalf("CompleteCheckoutSession: %v", err)
+	}
+	payment, err := f.service.ReconcileCheckoutSession(checkout.SessionID, models.Actor{ID: "test", Source: models.ChangeSourceWebhook})
+	if err != nil {
+		t.Fatalf("ReconcileCheckoutSession: %v", err)
+	}
+	if payment.Status != models.PaymentStatusAuthorized {
+		t.Errorf("payment status = %q, want authorized", payment.Status)
+	}
+}
+
+// newPaidPayment checks out the fixture's order of 29.99 CAD and settles it.
+func newPaidPayment(t *testing.T, f *paymentServiceFixture) *models.Payment {
+	t.Helper()
+
+	checkout, err := f.service.GeneratePaymentURL(f.order.OrderId, f.order.CustomerId, "")
+	if err != nil {
+		t.Fatalf("GeneratePaymentURL: %v", err)
+	}
+	if _, err := f.provider.CompleteCheckoutSession(checkout.SessionID); err != nil {
+		t.Fatalf("CompleteCheckoutSession: %v", err)
+	}
+	payment, err := f.service.ReconcileCheckoutSession(checkout.SessionID, models.Actor{ID: "test", Source: models.ChangeSourceWebhook})
+	if err != nil {
+		t.Fatalf("ReconcileCheckoutSession: %v", err)
+	}
+	return payment
+}
+
+func hasErrorType(err error, errorType errors.ErrorType) bool {
+	appErr, ok := errors.IsAppError(err)
+	return ok && appErr.Type == errorType
+}
+
+var (
+	refundClerk = models.Actor{ID: "clerk", Source: models.ChangeSourceRPC}
+	refundLead  = models.Actor{ID: "finance-lead", Source: models.ChangeSourceRPC}
+)
+
+func TestRefundApprovalThresholdIsCumulative(t *testing.T) {
+	f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+	payment := newPaidPayment(t, f)
+
+	refund, approval, err := f.service.RefundPayment(payment.TransactionID, money.New(1500, "cad"), "requested_by_customer", refundClerk, "")
+	if err != nil || refund == nil || approval != nil {
+		t.Fatalf("refunding 15.00 CAD = %v, %v, %v, want the refund issued", refund, approval, err)
+	}
+
+	// 10.00 CAD is below the threshold, but not on top of what was refunded.
+	refund, approval, err = f.service.RefundPayment(payment.TransactionID, money.New(1000, "cad"), "requested_by_customer", refundClerk, "")
+	if err != nil || refund != nil || approval == nil {
+		t.Fatalf("refunding another 10.00 CAD = %v, %v, %v, want an approval", refund, approval, err)
+	}
+	if approval.Amount != money.New(1000, "cad") || approval.RequestedBy != refundClerk.ID {
+		t.Errorf("approval is for %s requested by %q, want 10.00 CAD requested by clerk", approval.Amount, approval.RequestedBy)
+	}
+}
+
+func TestRefundsAwaitingApprovalCountTowardsTheThreshold(t *testing.T) {
+	f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+	payment := newPaidPayment(t, f)
+
+	_, approval, err := f.service.RefundPayment(payment.TransactionID, money.New(2500, "cad"), "requested_by_customer", refundClerk, "")
+	if err != nil || approval == nil {
+		t.Fatalf("RefundPayment = %v, %v, want an approval", approval, err)
+	}
+
+	// 2.00 CAD is below the threshold, but not on top of the refund awaiting approval.
+	refund, approval, err := f.service.RefundPayment(payment.TransactionID, money.New(200, "cad"), "requested_by_customer", refundClerk, "")
+	if err != nil || refund != nil || approval == nil {
+		t.Errorf("refunding another 2.00 CAD = %v, %v, %v, want an approval", refund, approval, err)
+	}
+}
+
+func TestRefundApprovalThresholdIsPerCurrency(t *testing.T) {
+	tests := []struct {
+		name       string
+		thresholds map[string]int64
+		approval   bool
+	}{
+		{"below the threshold", map[string]int64{"cad": 2000}, false},
+		{"above the threshold", map[string]int64{"cad": 500}, true},
+		{"approval turned off", map[string]int64{"cad": 0}, false},
+		{"no threshold for the currency", map[string]int64{"usd": 100000}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+			f.cfg.RefundApprovalThresholds = tt.thresholds
+			payment := newPaidPayment(t, f)
+
+			_, approval, err := f.service.RefundPayment(payment.TransactionID, money.New(1000, "cad"), "requested_by_customer", refundClerk, "")
+			if err != nil {
+				t.Fatalf("RefundPayment: %v", err)
+			}
+			if (approval != nil) != tt.approval {
+				t.Errorf("approval = %v, want one: %v", approval, tt.approval)
+			}
+		})
+	}
+}
+
+func TestDecidingRefundApprovalsRequiresAnotherApprover(t *testing.T) {
+	f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+	payment := newPaidPayment(t, f)
+
+	_, approval, err := f.service.RefundPayment(payment.TransactionID, money.New(2500, "cad"), "requested_by_customer", refundLead, "")
+	if err != nil || approval == nil {
+		t.Fatalf("RefundPayment = %v, %v, want an approval", approval, err)
+	}
+	approvalID := approval.ID.String()
+
+	if _, _, err := f.service.ApproveRefund(approvalID, refundClerk, ""); !hasErrorType(err, errors.AuthError) {
+		t.Errorf("approval by someone who is not an approver = %v, want an auth error", err)
+	}
+	if _, err := f.service.RejectRefund(approvalID, refundClerk, ""); !hasErrorType(err, errors.AuthError) {
+		t.Errorf("rejection by someone who is not an approver = %v, want an auth error", err)
+	}
+	if _, _, err := f.service.ApproveRefund(approvalID, refundLead, ""); !hasErrorType(err, errors.AuthError) {
+		t.Errorf("approval by the requester = %v, want an auth error", err)
+	}
+	if _, _, err := f.service.ApproveRefund(approvalID, models.Actor{ID: "Finance-Lead", Source: models.ChangeSourceRPC}, ""); !hasErrorType(err, errors.AuthError) {
+		t.Errorf("approval by the requester spelled in another case = %v, want an auth error", err)
+	}
+
+	// Approvers are matched whatever the case of the actor.
+	approved, refund, err := f.service.ApproveRefund(approvalID, models.Actor{ID: "Finance-Manager", Source: models.ChangeSourceRPC}, "checked")
+	if err != nil {
+		t.Fatalf("ApproveRefund: %v", err)
+	}
+	if approved.Status != models.RefundApprovalStatusApproved || refund.Status != models.RefundStatusSucceeded {
+		t.Errorf("approval is %s with a %s refund, want approved with a succeeded refund", approved.Status, refund.Status)
+	}
+}
+
+func TestApproveRefundAfterProviderFailure(t *testing.T) {
+	f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+	payment := newPaidPayment(t, f)
+	approver := models.Actor{ID: "finance-manager", Source: models.ChangeSourceRPC}
+
+	_, approval, err := f.service.RefundPayment(payment.TransactionID, money.New(2500, "cad"), "requested_by_customer", refundClerk, "")
+	if err != nil || approval == nil {
+		t.Fatalf("RefundPayment = %v, %v, want an approval", approval, err)
+	}
+	approvalID := approval.ID.String()
+
+	f.refunding.failures = 1
+	if _, _, err := f.service.ApproveRefund(approvalID, approver, ""); err == nil {
+		t.Fatal("ApproveRefund succeeded although the provider failed")
+	}
+	if pending, _ := f.approvals.GetApproval(approvalID); pending.Status != models.RefundApprovalStatusPending {
+		t.Fatalf("approval is %s after the refund failed, want pending", pending.Status)
+	}
+
+	approved, refund, err := f.service.ApproveRefund(approvalID, approver, "")
+	if err != nil {
+		t.Fatalf("retried ApproveRefund: %v", err)
+	}
+	if approved.Status != models.RefundApprovalStatusApproved || approved.RefundID == nil || *approved.RefundID != refund.ID {
+		t.Errorf("approval is %s with refund %v, want approved with refund %s", approved.Status, approved.RefundID, refund.ID)
+	}
+	if refund.Status != models.RefundStatusSucceeded {
+		t.Errorf("refund status = %q, want succeeded", refund.Status)
+	}
+
+	for _, key := range f.refunding.keys {
+		if !strings.HasPrefix(key, "refund-approval:"+approvalID+":") {
+			t.Errorf("refund idempotency key = %q, want one derived from approval %s", key, approvalID)
+		}
+	}
+
+	if _, _, err := f.service.ApproveRefund(approvalID, approver, ""); !hasErrorType(err, errors.ConflictError) {
+		t.Errorf("approving again = %v, want a conflict", err)
+	}
+	if got, _ := f.payments.GetPayment(payment.ID.String()); got.Status != models.PaymentStatusPartiallyRefunded {
+		t.Errorf("payment status = %q, want partially_refunded", got.Status)
+	}
+}
+
+func TestApproveRefundResubmitsAnInterruptedRefund(t *testing.T) {
+	f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+	payment := newPaidPayment(t, f)
+	approver := models.Actor{ID: "finance-manager", Source: models.ChangeSourceRPC}
+
+	_, approval, err := f.service.RefundPayment(payment.TransactionID, money.New(2500, "cad"), "requested_by_customer", refundClerk, "")
+	if err != nil || approval == nil {
+		t.Fatalf("RefundPayment = %v, %v, want an approval", approval, err)
+	}
+	approvalID := approval.ID.String()
+
+	// An earlier approval reserved the refund but stopped before issuing it.
+	reserved, _, err := f.approvals.ReserveRefund(approvalID, &models.Refund{PaymentID: payment.ID, Amount: approval.Amount, Reason: approval.Reason, Status: models.RefundStatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.service.RejectRefund(approvalID, approver, ""); !hasErrorType(err, errors.ConflictError) {
+		t.Errorf("rejecting an approval whose refund is being issued = %v, want a conflict", err)
+	}
+
+	_, refund, err := f.service.ApproveRefund(approvalID, approver, "")
+	if err != nil {
+		t.Fatalf("ApproveRefund: %v", err)
+	}
+	if refund.ID != reserved.ID {
+		t.Errorf("issued refund %s, want the reserved refund %s", refund.ID, reserved.ID)
+	}
+	if refunds, _ := f.refunds.ListRefundsByPaymentID(payment.ID.String()); len(refunds) != 1 {
+		t.Errorf("payment has %d refunds, want 1", len(refunds))
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const pendingSweepBatchSize = 100
+
+// pendingSweepActor attributes the changes made by the sweeper.
+var pendingSweepActor = models.Actor{
+	ID:     "pending-payment-sweeper",
+	Source: models.ChangeSourceJob,
+}
+
+type PendingPaymentSweeper interface {
+	SweepStalePayments() error
+}
+
+type pendingPaymentSweeper struct {
+	paymentRepo    repositories.PaymentRepository
+	paymentService PaymentService
+	cfg            *config.Config
+}
+
+func NewPendingPaymentSweeper(paymentRepo repositories.PaymentRepository, paymentService PaymentService, cfg *config.Config) PendingPaymentSweeper {
+	return &pendingPaymentSweeper{
+		paymentRepo:    paymentRepo,
+		paymentService: paymentService,
+		cfg:            cfg,
+	}
+}
+
+// SweepStalePayments reconciles payments that have been pending for longer than
+// the configured timeout with the payment provider, so an order is not left
+// waiting forever when the webhook that should have settled its payment was lost.
+// Payments that cannot be reconciled are logged and tried again on the next run.
+func (s *pendingPaymentSweeper) SweepStalePayments() error {
+	createdBefore := time.Now().Add(-s.cfg.PendingPaymentTimeout)
+	afterCreatedAt, afterID := time.Time{}, uuid.Nil
+
+	for {
+		payments, err := s.paymentRepo.ListStalePendingPayments(afterCreatedAt, afterID, createdBefore, pendingSweepBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range payments {
+			payment := &payments[i]
+			if err := s.paymentService.ReconcilePendingPayment(payment, pendingSweepActor); err != nil {
+				utils.Warn("Failed to reconcile stale pending payment", map[string]interface{}{
+					"payment_id":     payment.ID,
+					"order_id":       payment.OrderID,
+					"transaction_id": payment.TransactionID,
+					"error":          err.Error(),
+				})
+			}
+			afterCreatedAt, afterID = payment.CreatedAt, payment.ID
+		}
+
+		if len(payments) < pendingSweepBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/google/uuid"
+)
+
+// reconcileRecorder records the payments the sweeper reconciles.
+type reconcileRecorder struct {
+	PaymentService
+	reconciled map[uuid.UUID]int
+}
+
+func (s *reconcileRecorder) ReconcilePendingPayment(payment *models.Payment, actor models.Actor) error {
+	s.reconciled[payment.ID]++
+	return nil
+}
+
+func TestSweeperPagesThroughPaymentsCreatedAtTheSameTime(t *testing.T) {
+	payments := newMemoryPaymentRepository()
+	createdAt := time.Now().Add(-time.Hour)
+	// More than a batch of payments created at the same instant, so a page ends
+	// in the middle of them.
+	for i := 0; i < pendingSweepBatchSize+pendingSweepBatchSize/2; i++ {
+		payment := &models.Payment{
+			OrderID:       uuid.New(),
+			CustomerID:    uuid.New(),
+			TransactionID: uuid.NewString(),
+			Amount:        money.New(2999, "cad"),
+			Status:        models.PaymentStatusPending,
+		}
+		if err := payments.StorePayment(payment, models.PaymentStatusChange{}); err != nil {
+			t.Fatal(err)
+		}
+		payments.payments[payment.ID].CreatedAt = createdAt
+	}
+
+	recorder := &reconcileRecorder{reconciled: map[uuid.UUID]int{}}
+	sweeper := NewPendingPaymentSweeper(payments, recorder, &config.Config{PendingPaymentTimeout: time.Minute})
+	if err := sweeper.SweepStalePayments(); err != nil {
+		t.Fatalf("SweepStalePayments: %v", err)
+	}
+
+	for id := range payments.payments {
+		if got := recorder.reconciled[id]; got != 1 {
+			t.Errorf("payment %s was reconciled %d times, want once", id, got)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package services
+
+import "time"
+
+// retryBackoff doubles the delay with every attempt, starting at a second and
+// capped at max.
+func retryBackoff(attempts int, max time.Duration) time.Duration {
+	if attempts > 30 {
+		return max
+	}
+
+	backoff := time.Duration(1<<attempts) * time.Second
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
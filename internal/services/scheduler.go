@@ -0,0 +1,179 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+	"github.com/google/uuid"
+)
+
+// jobRunCleanupInterval is how often records of old job runs are removed.
+const jobRunCleanupInterval = time.Hour
+
+// Names of the background jobs, as recorded in job_leases and job_runs.
+const (
+	JobWebhookRetry        = "webhook_retry"
+	JobOutboxDispatch      = "outbox_dispatch"
+	JobAuthorizationCheck  = "authorization_check"
+	JobPendingPaymentSweep = "pending_payment_sweep"
+	JobRunCleanup          = "job_run_cleanup"
+)
+
+// Scheduler runs background jobs on an interval, on one replica at a time. Before
+// each run a replica takes the job's lease for one interval, renewing it for as
+// long as the run lasts, so a job runs at most once per interval across every
+// replica and is picked up by another replica if its holder goes away.
+type Scheduler interface {
+	Register(name string, interval time.Duration, run func() error)
+	Start()
+}
+
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	run      func() error
+}
+
+type scheduler struct {
+	jobRepo repositories.JobRepository
+	cfg     *config.Config
+	holder  string
+	jobs    []scheduledJob
+}
+
+// NewScheduler returns a scheduler that takes leases under a holder ID unique to
+// this process. It removes the records of runs older than the configured
+// retention as a job of its own.
+func NewScheduler(jobRepo repositories.JobRepository, cfg *config.Config) Scheduler {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "payment-svc"
+	}
+
+	s := &scheduler{
+		jobRepo: jobRepo,
+		cfg:     cfg,
+		holder:  fmt.Sprintf("%s-%s", hostname, uuid.NewString()[:8]),
+	}
+	s.Register(JobRunCleanup, jobRunCleanupInterval, s.deleteOldRuns)
+	return s
+}
+
+// Register adds a job to run every interval once the scheduler is started.
+func (s *scheduler) Register(name string, interval time.Duration, run func() error) {
+	s.jobs = append(s.jobs, scheduledJob{
+		name:     name,
+		interval: interval,
+		run:      run,
+	})
+}
+
+// Start blocks, running every registered job on its own interval.
+func (s *scheduler) Start() {
+	utils.Info("Starting job scheduler", map[string]interface{}{
+		"holder": s.holder,
+		"jobs":   len(s.jobs),
+	})
+
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func(job scheduledJob) {
+			defer wg.Done()
+
+			ticker := time.NewTicker(job.interval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if err := s.runIfLeased(job); err != nil {
+					utils.Error("Background job failed", map[string]interface{}{
+						"job":   job.name,
+						"error": err.Error(),
+					})
+				}
+			}
+		}(job)
+	}
+	wg.Wait()
+}
+
+// runIfLeased runs the job and records the run, unless another replica holds its
+// lease.
+func (s *scheduler) runIfLeased(job scheduledJob) error {
+	acquired, err := s.jobRepo.AcquireLease(job.name, s.holder, time.Now().Add(job.interval))
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return nil
+	}
+
+	run := &models.JobRun{
+		Job:       job.name,
+		Holder:    s.holder,
+		Status:    models.JobRunStatusRunning,
+		StartedAt: time.Now(),
+	}
+	if err := s.jobRepo.StartRun(run); err != nil {
+		return err
+	}
+
+	stop := s.renewLease(job)
+	runErr := job.run()
+	close(stop)
+
+	status, message := models.JobRunStatusSucceeded, ""
+	if runErr != nil {
+		status, message = models.JobRunStatusFailed, runErr.Error()
+	}
+	if err := s.jobRepo.FinishRun(run.ID.String(), status, message); err != nil {
+		return err
+	}
+	return runErr
+}
+
+func (s *scheduler) deleteOldRuns() error {
+	deleted, err := s.jobRepo.DeleteRunsBefore(time.Now().Add(-s.cfg.JobRunRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		utils.Info("Deleted old job runs", map[string]interface{}{
+			"deleted": deleted,
+		})
+	}
+	return nil
+}
+
+// renewLease keeps the job's lease for as long as a run lasts, until the
+// returned channel is closed, so a slow run is not joined by another replica.
+func (s *scheduler) renewLease(job scheduledJob) chan struct{} {
+	stop := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(job.interval / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := s.jobRepo.AcquireLease(job.name, s.holder, time.Now().Add(job.interval)); err != nil {
+					utils.Warn("Failed to renew job lease", map[string]interface{}{
+						"job":   job.name,
+						"error": err.Error(),
+					})
+				}
+			}
+		}
+	}()
+
+	return stop
+}
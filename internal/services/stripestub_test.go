@@ -0,0 +1,126 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/policies"
+	"github.com/PharmaKart/payment-svc/internal/proto"
+	"github.com/PharmaKart/payment-svc/internal/providers"
+	"github.com/PharmaKart/payment-svc/internal/stripestub"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+const stubWebhookSecret = "whsec_stub"
+
+// TestPaymentAgainstStripeStub runs a payment through the service against the
+// Stripe stub: checkout, the signed webhooks the stub delivers, and a refund.
+func TestPaymentAgainstStripeStub(t *testing.T) {
+	f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+	events := newMemoryWebhookEventRepository()
+
+	var webhooks WebhookService
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		event, err := webhook.ConstructEventWithOptions(payload, r.Header.Get("Stripe-Signature"), stubWebhookSecret, webhook.ConstructEventOptions{
+			IgnoreAPIVersionMismatch: true,
+		})
+		if err != nil {
+			t.Errorf("webhook with invalid signature: %v", err)
+			http.Error(w, "invalid signature", http.StatusBadRequest)
+			return
+		}
+		if err := webhooks.IngestEvent(event, payload); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(receiver.Close)
+
+	stub := httptest.NewServer(stripestub.New(stripestub.Config{
+		PublicURL:     "http://checkout.test",
+		WebhookURL:    receiver.URL,
+		WebhookSecret: stubWebhookSecret,
+	}))
+	t.Cleanup(stub.Close)
+
+	f.cfg.StripeSecretKey = "sk_test_stub"
+	f.cfg.StripeAPIURL = stub.URL
+	f.cfg.StripeHTTPTimeout = 5 * time.Second
+	f.cfg.FrontendURL = "http://frontend.test"
+	f.cfg.WebhookMaxAttempts = 3
+	provider := providers.NewStripeProvider(providers.NewStripeClient(f.cfg))
+	var orderClient proto.OrderServiceClient = &stubOrderClient{order: f.order}
+	service := NewPaymentService(f.payments, f.refunds, f.approvals, f.sessions, &orderClient, provider, policies.NewPrescriptionPolicy(policies.DefaultPrescriptionRules()), f.cfg)
+	webhooks = NewWebhookService(events, service, nil, f.cfg)
+
+	checkout, err := service.GeneratePaymentURL(f.order.OrderId, f.order.CustomerId, "")
+	if err != nil {
+		t.Fatalf("GeneratePaymentURL: %v", err)
+	}
+
+	// The customer pays, and the stub delivers checkout.session.completed before
+	// it responds.
+	resp, err := http.Post(stub.URL+"/_stub/checkout/sessions/"+checkout.SessionID+"/complete", "application/x-www-form-urlencoded", nil)
+	if err != nil {
+		t.Fatalf("completing the session: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("completing the session responded with %s", resp.Status)
+	}
+
+	payment, err := service.GetPayment(checkout.PaymentID)
+	if err != nil {
+		t.Fatalf("GetPayment: %v", err)
+	}
+	if payment.Status != models.PaymentStatusSuccessful || payment.Amount != money.New(2999, "cad") {
+		t.Fatalf("payment is %s for %s, want successful for 29.99 CAD", payment.Status, payment.Amount)
+	}
+	if payment.TransactionID == checkout.SessionID {
+		t.Errorf("payment still has the session ID %s as its transaction ID, want its PaymentIntent", payment.TransactionID)
+	}
+
+	refund, _, err := service.RefundPayment(payment.TransactionID, money.New(1000, "cad"), "requested_by_customer", refundClerk, "refund-1")
+	if err != nil {
+		t.Fatalf("RefundPayment: %v", err)
+	}
+	if refund.Status != models.RefundStatusSucceeded || refund.StripeRefundID == "" {
+		t.Errorf("refund is %s with Stripe ID %q, want succeeded with a Stripe ID", refund.Status, refund.StripeRefundID)
+	}
+
+	// refund.created is delivered in the background; it must leave the refund
+	// as it is.
+	waitForProcessedEvents(t, events, 2)
+	got, _ := f.refunds.GetRefund(refund.ID.String())
+	if got.Status != models.RefundStatusSucceeded || got.StripeRefundID != refund.StripeRefundID {
+		t.Errorf("ledger refund is %s with Stripe ID %q, want succeeded with %s", got.Status, got.StripeRefundID, refund.StripeRefundID)
+	}
+	if refunded, _ := service.GetPayment(payment.ID.String()); refunded.Status != models.PaymentStatusPartiallyRefunded {
+		t.Errorf("payment status = %q, want partially_refunded", refunded.Status)
+	}
+}
+
+func waitForProcessedEvents(t *testing.T, events *memoryWebhookEventRepository, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		processed, _, _ := events.ListEventsByStatus(models.WebhookEventStatusProcessed, 1, 100)
+		if len(processed) >= want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d webhook events were processed, want %d", len(processed), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
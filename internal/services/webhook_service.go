@@ -0,0 +1,357 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v81"
+)
+
+const (
+	// webhookProcessingTimeout is how long an event may stay in processing before
+	// another worker is allowed to pick it up again.
+	webhookProcessingTimeout = 5 * time.Minute
+	webhookRetryBatchSize    = 100
+	webhookMaxRetryBackoff   = time.Hour
+)
+
+type WebhookService interface {
+	IngestEvent(event stripe.Event, payload []byte) error
+	ProcessEvent(eventID string) error
+	RetryPendingEvents() error
+	ListFailedEvents(page int32, limit int32) ([]models.WebhookEvent, int64, error)
+	ReplayEvent(eventID string) error
+}
+
+type webhookService struct {
+	webhookEventRepo repositories.WebhookEventRepository
+	paymentService   PaymentService
+	disputeService   DisputeService
+	cfg              *config.Config
+}
+
+func NewWebhookService(webhookEventRepo repositories.WebhookEventRepository, paymentService PaymentService, disputeService DisputeService, cfg *config.Config) WebhookService {
+	return &webhookService{
+		webhookEventRepo: webhookEventRepo,
+		paymentService:   paymentService,
+		disputeService:   disputeService,
+		cfg:              cfg,
+	}
+}
+
+// IngestEvent records a verified Stripe event in the inbox and attempts to process
+// it. Redeliveries of an already processed event are ignored. Processing failures
+// are recorded on the event and retried later, so only a failure to persist the
+// event is returned to the caller.
+func (s *webhookService) IngestEvent(event stripe.Event, payload []byte) error {
+	created, err := s.webhookEventRepo.StoreEvent(&models.WebhookEvent{
+		ID:      event.ID,
+		Type:    string(event.Type),
+		Payload: payload,
+		Status:  models.WebhookEventStatusPending,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		existing, err := s.webhookEventRepo.GetEvent(event.ID)
+		if err != nil {
+			return err
+		}
+
+		if existing.Status == models.WebhookEventStatusProcessed {
+			utils.Info("Ignoring duplicate webhook event", map[string]interface{}{
+				"event_id":   event.ID,
+				"event_type": event.Type,
+			})
+			return nil
+		}
+	}
+
+	if err := s.ProcessEvent(event.ID); err != nil {
+		utils.Warn("Webhook event processing failed, will retry", map[string]interface{}{
+			"event_id":   event.ID,
+			"event_type": event.Type,
+			"error":      err.Error(),
+		})
+	}
+
+	return nil
+}
+
+// ProcessEvent claims a stored event and runs its handler, recording the outcome.
+// Events claimed by another worker are skipped.
+func (s *webhookService) ProcessEvent(eventID string) error {
+	claimed, err := s.webhookEventRepo.ClaimEvent(eventID, time.Now().Add(-webhookProcessingTimeout))
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	stored, err := s.webhookEventRepo.GetEvent(eventID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.handleEvent(stored); err != nil {
+		if markErr := s.recordFailedAttempt(stored, err); markErr != nil {
+			return markErr
+		}
+		return err
+	}
+
+	return s.webhookEventRepo.MarkEventProcessed(eventID)
+}
+
+// recordFailedAttempt schedules the event's next attempt, backing off
+// exponentially, or gives up on it once it has used up its attempts.
+func (s *webhookService) recordFailedAttempt(event *models.WebhookEvent, err error) error {
+	if event.Attempts < s.cfg.WebhookMaxAttempts {
+		return s.webhookEventRepo.ScheduleEventRetry(event.ID, err.Error(), time.Now().Add(retryBackoff(event.Attempts, webhookMaxRetryBackoff)))
+	}
+
+	utils.Error("Giving up on webhook event", map[string]interface{}{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+		"attempts":   event.Attempts,
+		"error":      err.Error(),
+	})
+	return s.webhookEventRepo.MarkEventFailed(event.ID, err.Error())
+}
+
+// RetryPendingEvents reprocesses events that are due. Events that fail again are
+// logged and left for their next attempt; only a failure to list them is
+// returned.
+func (s *webhookService) RetryPendingEvents() error {
+	now := time.Now()
+	events, err := s.webhookEventRepo.ListRetryableEvents(now, now.Add(-webhookProcessingTimeout), webhookRetryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if err := s.ProcessEvent(event.ID); err != nil {
+			utils.Warn("Webhook event retry failed", map[string]interface{}{
+				"event_id":   event.ID,
+				"event_type": event.Type,
+				"attempts":   event.Attempts + 1,
+				"error":      err.Error(),
+			})
+		}
+	}
+
+	return nil
+}
+
+func (s *webhookService) ListFailedEvents(page int32, limit int32) ([]models.WebhookEvent, int64, error) {
+	return s.webhookEventRepo.ListEventsByStatus(models.WebhookEventStatusFailed, page, limit)
+}
+
+// ReplayEvent reprocesses a failed or pending event immediately, bypassing the
+// retry backoff. A failed event that fails again stays failed.
+func (s *webhookService) ReplayEvent(eventID string) error {
+	event, err := s.webhookEventRepo.GetEvent(eventID)
+	if err != nil {
+		return err
+	}
+
+	if event.Status != models.WebhookEventStatusFailed && event.Status != models.WebhookEventStatusPending {
+		return errors.NewConflictError(fmt.Sprintf("Webhook event '%s' is %s and cannot be replayed", eventID, event.Status))
+	}
+
+	return s.ProcessEvent(eventID)
+}
+
+func (s *webhookService) handleEvent(stored *models.WebhookEvent) error {
+	var event stripe.Event
+	if err := json.Unmarshal(stored.Payload, &event); err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case stripe.EventTypeCheckoutSessionCompleted:
+		return s.handleCheckoutSessionCompleted(event)
+	case stripe.EventTypeCheckoutSessionAsyncPaymentSucceeded, stripe.EventTypeCheckoutSessionAsyncPaymentFailed:
+		return s.handleCheckoutSessionAsyncPayment(event)
+	case stripe.EventTypeCheckoutSessionExpired:
+		return s.handleCheckoutSessionExpired(event)
+	case stripe.EventTypeRefundCreated, stripe.EventTypeRefundUpdated, stripe.EventTypeRefundFailed:
+		return s.handleRefundUpdated(event)
+	case stripe.EventTypePaymentIntentAmountCapturableUpdated, stripe.EventTypePaymentIntentSucceeded, stripe.EventTypePaymentIntentCanceled:
+		return s.handlePaymentIntentUpdated(event)
+	case stripe.EventTypeChargeDisputeCreated, stripe.EventTypeChargeDisputeUpdated, stripe.EventTypeChargeDisputeClosed:
+		return s.handleDisputeUpdated(event)
+	default:
+		utils.Info("Ignoring unhandled webhook event", map[string]interface{}{
+			"event_id":   event.ID,
+			"event_type": event.Type,
+		})
+		return nil
+	}
+}
+
+func (s *webhookService) handleCheckoutSessionCompleted(event stripe.Event) error {
+	var session stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+		return err
+	}
+
+	// Completed sessions paid with a delayed method such as pre-authorized debit
+	// are still unpaid and stay pending until the funds arrive.
+	status := models.PaymentStatusPending
+	if session.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid {
+		status = models.PaymentStatusSuccessful
+	}
+
+	payment, err := paymentFromSession(session, status)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.paymentService.StorePayment(payment, webhookActor(event)); err != nil {
+		return err
+	}
+
+	return s.paymentService.UpdateCheckoutSessionStatus(session.ID, models.CheckoutSessionStatusComplete)
+}
+
+// handleCheckoutSessionAsyncPayment settles a payment left pending by a delayed
+// payment method once Stripe reports whether its funds arrived.
+func (s *webhookService) handleCheckoutSessionAsyncPayment(event stripe.Event) error {
+	var session stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+		return err
+	}
+
+	status := models.PaymentStatusSuccessful
+	if event.Type == stripe.EventTypeCheckoutSessionAsyncPaymentFailed {
+		status = models.PaymentStatusFailed
+	}
+
+	payment, err := paymentFromSession(session, status)
+	if err != nil {
+		return err
+	}
+	if status == models.PaymentStatusFailed {
+		payment.FailureReason = "Delayed payment failed"
+	}
+
+	_, err = s.paymentService.StorePayment(payment, webhookActor(event))
+	return err
+}
+
+func (s *webhookService) handleCheckoutSessionExpired(event stripe.Event) error {
+	var session stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+		return err
+	}
+
+	return s.paymentService.ExpireCheckoutSession(session.ID, webhookActor(event))
+}
+
+// paymentFromSession builds the payment reported by a checkout session event.
+func paymentFromSession(session stripe.CheckoutSession, status string) (*models.Payment, error) {
+	orderIdValue := session.ClientReferenceID
+	if orderIdValue == "" {
+		orderIdValue = session.Metadata["order_id"]
+	}
+
+	orderId, err := uuid.Parse(orderIdValue)
+	if err != nil {
+		return nil, errors.NewValidationError("order_id", fmt.Sprintf("Invalid UUID: %s", orderIdValue))
+	}
+
+	customerId, err := uuid.Parse(session.Metadata["customer_id"])
+	if err != nil {
+		return nil, errors.NewValidationError("customer_id", fmt.Sprintf("Invalid UUID: %s", session.Metadata["customer_id"]))
+	}
+
+	transactionId := session.ID
+	if session.PaymentIntent != nil && session.PaymentIntent.ID != "" {
+		transactionId = session.PaymentIntent.ID
+	}
+
+	return &models.Payment{
+		OrderID:           orderId,
+		CustomerID:        customerId,
+		TransactionID:     transactionId,
+		CheckoutSessionID: session.ID,
+		Amount:            money.New(session.AmountTotal, string(session.Currency)),
+		Status:            status,
+	}, nil
+}
+
+// handleRefundUpdated brings the refund's ledger entry in line with Stripe.
+// charge.refunded events are not handled, as their charge no longer lists its
+// refunds; every refund is reported through refund.* events.
+func (s *webhookService) handleRefundUpdated(event stripe.Event) error {
+	var stripeRefund stripe.Refund
+	if err := json.Unmarshal(event.Data.Raw, &stripeRefund); err != nil {
+		return err
+	}
+
+	return s.paymentService.SyncRefund(stripeRefund.ID, webhookActor(event))
+}
+
+// handlePaymentIntentUpdated keeps manual capture payments in line with their
+// PaymentIntent. An authorization that cannot be matched to a payment yet is
+// retried, since the payment may still be waiting for its checkout session;
+// other PaymentIntents without a payment are not ours to track.
+func (s *webhookService) handlePaymentIntentUpdated(event stripe.Event) error {
+	var intent stripe.PaymentIntent
+	if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+		return err
+	}
+
+	err := s.paymentService.SyncPaymentIntent(intent.ID, webhookActor(event))
+	if isNotFoundError(err) && event.Type != stripe.EventTypePaymentIntentAmountCapturableUpdated {
+		return nil
+	}
+	return err
+}
+
+// handleDisputeUpdated records a dispute against our payment. A dispute on a
+// PaymentIntent without a payment is retried, since the payment may not have
+// been stored yet; it ends up failed if it never is.
+func (s *webhookService) handleDisputeUpdated(event stripe.Event) error {
+	var stripeDispute stripe.Dispute
+	if err := json.Unmarshal(event.Data.Raw, &stripeDispute); err != nil {
+		return err
+	}
+
+	if stripeDispute.PaymentIntent == nil {
+		return nil
+	}
+
+	update := &models.Dispute{
+		StripeDisputeID: stripeDispute.ID,
+		Amount:          money.New(stripeDispute.Amount, string(stripeDispute.Currency)),
+		Reason:          string(stripeDispute.Reason),
+		Status:          string(stripeDispute.Status),
+	}
+	if stripeDispute.EvidenceDetails != nil && stripeDispute.EvidenceDetails.DueBy > 0 {
+		dueBy := time.Unix(stripeDispute.EvidenceDetails.DueBy, 0)
+		update.EvidenceDueBy = &dueBy
+	}
+
+	return s.disputeService.RecordDispute(update, stripeDispute.PaymentIntent.ID, webhookActor(event))
+}
+
+// webhookActor attributes changes made while processing an event to that event.
+func webhookActor(event stripe.Event) models.Actor {
+	return models.Actor{
+		ID:     "stripe:" + event.ID,
+		Source: models.ChangeSourceWebhook,
+	}
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/providers"
+	"github.com/PharmaKart/payment-svc/internal/repositories"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/errors"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/stripe/stripe-go/v81"
+)
+
+// memoryWebhookEventRepository keeps events in memory and claims and schedules
+// them as the database repository does.
+type memoryWebhookEventRepository struct {
+	mu     sync.Mutex
+	events map[string]*models.WebhookEvent
+}
+
+func newMemoryWebhookEventRepository() *memoryWebhookEventRepository {
+	return &memoryWebhookEventRepository{events: map[string]*models.WebhookEvent{}}
+}
+
+func (r *memoryWebhookEventRepository) StoreEvent(event *models.WebhookEvent) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.events[event.ID]; ok {
+		return false, nil
+	}
+	event.CreatedAt = time.Now()
+	event.UpdatedAt = event.CreatedAt
+	stored := *event
+	r.events[event.ID] = &stored
+	return true, nil
+}
+
+func (r *memoryWebhookEventRepository) GetEvent(eventID string) (*models.WebhookEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event, ok := r.events[eventID]
+	if !ok {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Webhook event '%s' not found", eventID))
+	}
+	copied := *event
+	return &copied, nil
+}
+
+func (r *memoryWebhookEventRepository) ClaimEvent(eventID string, staleBefore time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event, ok := r.events[eventID]
+	if !ok {
+		return false, nil
+	}
+	switch {
+	case event.Status == models.WebhookEventStatusPending, event.Status == models.WebhookEventStatusFailed:
+	case event.Status == models.WebhookEventStatusProcessing && event.UpdatedAt.Before(staleBefore):
+	default:
+		return false, nil
+	}
+	event.Status = models.WebhookEventStatusProcessing
+	event.Attempts++
+	event.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (r *memoryWebhookEventRepository) update(eventID string, apply func(*models.WebhookEvent)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event, ok := r.events[eventID]
+	if !ok {
+		return errors.NewNotFoundError(fmt.Sprintf("Webhook event '%s' not found", eventID))
+	}
+	apply(event)
+	event.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *memoryWebhookEventRepository) MarkEventProcessed(eventID string) error {
+	return r.update(eventID, func(event *models.WebhookEvent) {
+		now := time.Now()
+		event.Status = models.WebhookEventStatusProcessed
+		event.LastError = ""
+		event.ProcessedAt = &now
+	})
+}
+
+func (r *memoryWebhookEventRepository) ScheduleEventRetry(eventID string, lastError string, nextAttemptAt time.Time) error {
+	return r.update(eventID, func(event *models.WebhookEvent) {
+		event.Status = models.WebhookEventStatusPending
+		event.LastError = lastError
+		event.NextAttemptAt = &nextAttemptAt
+	})
+}
+
+func (r *memoryWebhookEventRepository) MarkEventFailed(eventID string, lastError string) error {
+	return r.update(eventID, func(event *models.WebhookEvent) {
+		event.Status = models.WebhookEventStatusFailed
+		event.LastError = lastError
+		event.NextAttemptAt = nil
+	})
+}
+
+func (r *memoryWebhookEventRepository) ListEventsByStatus(status string, page int32, limit int32) ([]models.WebhookEvent, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var events []models.WebhookEvent
+	for _, event := range r.events {
+		if event.Status == status {
+			events = append(events, *event)
+		}
+	}
+	return events, int64(len(events)), nil
+}
+
+func (r *memoryWebhookEventRepository) ListRetryableEvents(now time.Time, staleBefore time.Time, limit int) ([]models.WebhookEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var events []models.WebhookEvent
+	for _, event := range r.events {
+		due := event.Status == models.WebhookEventStatusPending && (event.NextAttemptAt == nil || !event.NextAttemptAt.After(now))
+		stuck := event.Status == models.WebhookEventStatusProcessing && event.UpdatedAt.Before(staleBefore)
+		if due || stuck {
+			events = append(events, *event)
+		}
+	}
+	return events, nil
+}
+
+// makeDue ends the backoff of a pending event.
+func (r *memoryWebhookEventRepository) makeDue(eventID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[eventID].NextAttemptAt = nil
+}
+
+var _ repositories.WebhookEventRepository = (*memoryWebhookEventRepository)(nil)
+
+// refundSyncer counts the refund events handed to the payment service and fails
+// as many of them as asked.
+type refundSyncer struct {
+	PaymentService
+	failures int
+	calls    int
+}
+
+func (s *refundSyncer) SyncRefund(stripeRefundID string, actor models.Actor) error {
+	s.calls++
+	if s.failures > 0 {
+		s.failures--
+		return fmt.Errorf("provider unavailable")
+	}
+	return nil
+}
+
+func newInboxFixture(t *testing.T, maxAttempts int) (*webhookService, *memoryWebhookEventRepository, *refundSyncer) {
+	t.Helper()
+
+	events := newMemoryWebhookEventRepository()
+	syncer := &refundSyncer{}
+	return &webhookService{
+		webhookEventRepo: events,
+		paymentService:   syncer,
+		cfg:              &config.Config{WebhookMaxAttempts: maxAttempts},
+	}, events, syncer
+}
+
+func refundEvent(t *testing.T, eventID string) (stripe.Event, []byte) {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":     eventID,
+		"object": "event",
+		"type":   "refund.updated",
+		"data":   map[string]interface{}{"object": map[string]interface{}{"id": "re_test", "object": "refund"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event stripe.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	return event, payload
+}
+
+func TestDuplicateWebhookDeliveryIsProcessedOnce(t *testing.T) {
+	webhooks, events, syncer := newInboxFixture(t, 3)
+	event, payload := refundEvent(t, "evt_duplicate")
+
+	for range 2 {
+		if err := webhooks.IngestEvent(event, payload); err != nil {
+			t.Fatalf("IngestEvent: %v", err)
+		}
+	}
+
+	if syncer.calls != 1 {
+		t.Errorf("event handled %d times, want once", syncer.calls)
+	}
+	if stored, _ := events.GetEvent(event.ID); stored.Status != models.WebhookEventStatusProcessed || stored.Attempts != 1 {
+		t.Errorf("event is %s after %d attempts, want processed after 1", stored.Status, stored.Attempts)
+	}
+}
+
+func TestFailedWebhookEventIsRetried(t *testing.T) {
+	webhooks, events, syncer := newInboxFixture(t, 3)
+	event, payload := refundEvent(t, "evt_retried")
+	syncer.failures = 1
+
+	if err := webhooks.IngestEvent(event, payload); err != nil {
+		t.Fatalf("IngestEvent = %v, want the failure kept for a retry", err)
+	}
+	stored, _ := events.GetEvent(event.ID)
+	if stored.Status != models.WebhookEventStatusPending || stored.LastError == "" || stored.NextAttemptAt == nil || !stored.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("failed event is %s with error %q due at %v, want pending with the error and a later attempt", stored.Status, stored.LastError, stored.NextAttemptAt)
+	}
+
+	// Nothing is retried while the event backs off.
+	if err := webhooks.RetryPendingEvents(); err != nil {
+		t.Fatal(err)
+	}
+	if syncer.calls != 1 {
+		t.Fatalf("event handled %d times during its backoff, want once", syncer.calls)
+	}
+
+	events.makeDue(event.ID)
+	if err := webhooks.RetryPendingEvents(); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := events.GetEvent(event.ID); stored.Status != models.WebhookEventStatusProcessed || stored.Attempts != 2 {
+		t.Errorf("event is %s after %d attempts, want processed after 2", stored.Status, stored.Attempts)
+	}
+}
+
+func TestWebhookEventIsDeadLetteredAfterMaxAttempts(t *testing.T) {
+	webhooks, events, syncer := newInboxFixture(t, 3)
+	event, payload := refundEvent(t, "evt_failing")
+	syncer.failures = 10
+
+	if err := webhooks.IngestEvent(event, payload); err != nil {
+		t.Fatalf("IngestEvent: %v", err)
+	}
+	for range 4 {
+		if stored, _ := events.GetEvent(event.ID); stored.Status == models.WebhookEventStatusPending {
+			events.makeDue(event.ID)
+		}
+		if err := webhooks.RetryPendingEvents(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, _ := events.GetEvent(event.ID)
+	if stored.Status != models.WebhookEventStatusFailed || stored.Attempts != 3 || syncer.calls != 3 {
+		t.Fatalf("event is %s after %d attempts and %d calls, want failed after 3", stored.Status, stored.Attempts, syncer.calls)
+	}
+	if failed, total, _ := webhooks.ListFailedEvents(1, 10); total != 1 || failed[0].ID != event.ID {
+		t.Errorf("failed events = %v, want %s", failed, event.ID)
+	}
+
+	// A failed event is only processed again when it is replayed.
+	syncer.failures = 0
+	if err := webhooks.ReplayEvent(event.ID); err != nil {
+		t.Fatalf("ReplayEvent: %v", err)
+	}
+	if stored, _ := events.GetEvent(event.ID); stored.Status != models.WebhookEventStatusProcessed {
+		t.Errorf("replayed event is %s, want processed", stored.Status)
+	}
+}
+
+func TestLateRefundEventDoesNotReopenARefund(t *testing.T) {
+	f := newPaymentServiceFixture(t, providers.FakeOutcomeSuccess)
+	payment := newPaidPayment(t, f)
+	webhooks := &webhookService{paymentService: f.service}
+
+	refund, _, err := f.service.RefundPayment(payment.TransactionID, money.New(1000, "cad"), "requested_by_customer", refundClerk, "")
+	if err != nil {
+		t.Fatalf("RefundPayment: %v", err)
+	}
+
+	// refund.created, still reporting the refund as pending, arrives after the
+	// refund succeeded.
+	raw, _ := json.Marshal(map[string]interface{}{
+		"id":             refund.StripeRefundID,
+		"object":         "refund",
+		"amount":         1000,
+		"currency":       "cad",
+		"status":         "pending",
+		"payment_intent": payment.TransactionID,
+		"metadata":       map[string]string{"refund_id": refund.ID.String()},
+	})
+	event := stripe.Event{ID: "evt_late", Type: stripe.EventTypeRefundCreated, Data: &stripe.EventData{Raw: raw}}
+	if err := webhooks.handleRefundUpdated(event); err != nil {
+		t.Fatalf("handleRefundUpdated: %v", err)
+	}
+
+	got, _ := f.refunds.GetRefund(refund.ID.String())
+	if got.Status != models.RefundStatusSucceeded {
+		t.Errorf("refund status = %q, want succeeded", got.Status)
+	}
+	if paid, _ := f.payments.GetPayment(payment.ID.String()); paid.Status != models.PaymentStatusPartiallyRefunded {
+		t.Errorf("payment status = %q, want partially_refunded", paid.Status)
+	}
+}
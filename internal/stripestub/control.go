@@ -0,0 +1,377 @@
+package stripestub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+// Outcomes accepted by the control endpoints.
+const (
+	OutcomeSuccess = "success"
+	OutcomeDecline = "decline"
+	OutcomeAsync   = "async"
+	OutcomeFail    = "fail"
+	OutcomeWon     = "won"
+	OutcomeLost    = "lost"
+)
+
+// controlResponse lists the events a control call emitted and whether they
+// reached the webhook endpoint.
+type controlResponse struct {
+	Events         []json.RawMessage `json:"events"`
+	DeliveryErrors []string          `json:"delivery_errors,omitempty"`
+}
+
+// completeCheckoutSession plays the customer paying on the checkout page. The
+// outcome form value picks what happens to the payment: success captures it, or
+// only authorizes it for a manual capture session; async leaves it processing as
+// a delayed method would; and decline rejects the card and leaves the session
+// open.
+func (s *Server) completeCheckoutSession(w http.ResponseWriter, r *http.Request) {
+	outcome := r.FormValue("outcome")
+	if outcome == "" {
+		outcome = OutcomeSuccess
+	}
+
+	s.mu.Lock()
+	session, ok := s.sessions[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		writeNotFound(w, "checkout.session", r.PathValue("id"))
+		return
+	}
+	if session.Status != string(stripe.CheckoutSessionStatusOpen) {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("Checkout Session %s is %s and cannot be completed", session.ID, session.Status), "")
+		return
+	}
+
+	intent := s.intentForSession(session)
+
+	var payloads [][]byte
+	switch outcome {
+	case OutcomeSuccess:
+		session.Status = string(stripe.CheckoutSessionStatusComplete)
+		if intent.CaptureMethod == string(stripe.PaymentIntentCaptureMethodManual) {
+			intent.Status = string(stripe.PaymentIntentStatusRequiresCapture)
+			intent.AmountCapturable = intent.Amount
+			intent.LatestCharge = s.newCharge(intent, false)
+			payloads = append(payloads, s.emit("payment_intent.amount_capturable_updated", *intent))
+		} else {
+			intent.Status = string(stripe.PaymentIntentStatusSucceeded)
+			intent.AmountReceived = intent.Amount
+			intent.LatestCharge = s.newCharge(intent, true)
+			session.PaymentStatus = string(stripe.CheckoutSessionPaymentStatusPaid)
+		}
+		payloads = append(payloads, s.emit("checkout.session.completed", *session))
+	case OutcomeAsync:
+		intent.Status = string(stripe.PaymentIntentStatusProcessing)
+		session.Status = string(stripe.CheckoutSessionStatusComplete)
+		payloads = append(payloads, s.emit("checkout.session.completed", *session))
+	case OutcomeDecline:
+		intent.Status = string(stripe.PaymentIntentStatusRequiresPaymentMethod)
+		payloads = append(payloads, s.emit("payment_intent.payment_failed", *intent))
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("Unknown outcome %q", outcome), "outcome")
+		return
+	}
+	s.mu.Unlock()
+
+	s.respondWithDeliveries(w, payloads)
+}
+
+// settlePaymentIntent resolves a payment left processing by an async checkout,
+// with an outcome of success or fail.
+func (s *Server) settlePaymentIntent(w http.ResponseWriter, r *http.Request) {
+	outcome := r.FormValue("outcome")
+	if outcome == "" {
+		outcome = OutcomeSuccess
+	}
+
+	s.mu.Lock()
+	intent, ok := s.intents[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		writeNotFound(w, "payment_intent", r.PathValue("id"))
+		return
+	}
+	if intent.Status != string(stripe.PaymentIntentStatusProcessing) {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("PaymentIntent %s is %s and cannot be settled", intent.ID, intent.Status), "")
+		return
+	}
+
+	session := s.sessionForIntent(intent.ID)
+
+	var payloads [][]byte
+	switch outcome {
+	case OutcomeSuccess:
+		intent.Status = string(stripe.PaymentIntentStatusSucceeded)
+		intent.AmountReceived = intent.Amount
+		payloads = append(payloads, s.emit("payment_intent.succeeded", *intent))
+		if session != nil {
+			session.PaymentStatus = string(stripe.CheckoutSessionPaymentStatusPaid)
+			payloads = append(payloads, s.emit("checkout.session.async_payment_succeeded", *session))
+		}
+	case OutcomeFail:
+		intent.Status = string(stripe.PaymentIntentStatusRequiresPaymentMethod)
+		payloads = append(payloads, s.emit("payment_intent.payment_failed", *intent))
+		if session != nil {
+			payloads = append(payloads, s.emit("checkout.session.async_payment_failed", *session))
+		}
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("Unknown outcome %q", outcome), "outcome")
+		return
+	}
+	s.mu.Unlock()
+
+	s.respondWithDeliveries(w, payloads)
+}
+
+// expireAuthorization plays the card network releasing an uncaptured
+// authorization once its capture window has passed.
+func (s *Server) expireAuthorization(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	intent, ok := s.intents[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		writeNotFound(w, "payment_intent", r.PathValue("id"))
+		return
+	}
+	if intent.Status != string(stripe.PaymentIntentStatusRequiresCapture) {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("PaymentIntent %s is %s and has no authorization to expire", intent.ID, intent.Status), "")
+		return
+	}
+
+	s.cancelIntent(intent, string(stripe.PaymentIntentCancellationReasonAutomatic))
+	payloads := [][]byte{s.emit("payment_intent.canceled", *intent)}
+	s.mu.Unlock()
+
+	s.respondWithDeliveries(w, payloads)
+}
+
+// settleRefund resolves a pending refund with an outcome of success or fail. A
+// failed refund takes its failure_reason form value, defaulting to unknown.
+func (s *Server) settleRefund(w http.ResponseWriter, r *http.Request) {
+	outcome := r.FormValue("outcome")
+	if outcome == "" {
+		outcome = OutcomeSuccess
+	}
+
+	s.mu.Lock()
+	pending, ok := s.refunds[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		writeNotFound(w, "refund", r.PathValue("id"))
+		return
+	}
+	if pending.Status != string(stripe.RefundStatusPending) {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("Refund %s is %s and cannot be settled", pending.ID, pending.Status), "")
+		return
+	}
+
+	var payloads [][]byte
+	switch outcome {
+	case OutcomeSuccess:
+		pending.Status = string(stripe.RefundStatusSucceeded)
+		payloads = append(payloads, s.emit("refund.updated", *pending))
+	case OutcomeFail:
+		pending.Status = string(stripe.RefundStatusFailed)
+		pending.FailureReason = r.FormValue("failure_reason")
+		if pending.FailureReason == "" {
+			pending.FailureReason = string(stripe.RefundFailureReasonUnknown)
+		}
+		payloads = append(payloads, s.emit("refund.failed", *pending))
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("Unknown outcome %q", outcome), "outcome")
+		return
+	}
+	s.mu.Unlock()
+
+	s.respondWithDeliveries(w, payloads)
+}
+
+// openDispute plays the customer's bank disputing a captured payment. The
+// reason form value defaults to fraudulent and the amount to everything
+// captured; inquiry=true opens an inquiry rather than a chargeback.
+func (s *Server) openDispute(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error(), "")
+		return
+	}
+
+	s.mu.Lock()
+	intent, ok := s.intents[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		writeNotFound(w, "payment_intent", r.PathValue("id"))
+		return
+	}
+	if intent.Status != string(stripe.PaymentIntentStatusSucceeded) || intent.LatestCharge == nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("PaymentIntent %s is %s and has no charge to dispute", intent.ID, intent.Status), "")
+		return
+	}
+
+	amount := intent.AmountReceived
+	if value := r.PostFormValue("amount"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 || parsed > intent.AmountReceived {
+			s.mu.Unlock()
+			writeError(w, http.StatusBadRequest, "", "Invalid amount", "amount")
+			return
+		}
+		amount = parsed
+	}
+
+	reason := r.PostFormValue("reason")
+	if reason == "" {
+		reason = string(stripe.DisputeReasonFraudulent)
+	}
+
+	status := string(stripe.DisputeStatusNeedsResponse)
+	if r.PostFormValue("inquiry") == "true" {
+		status = string(stripe.DisputeStatusWarningNeedsResponse)
+	}
+
+	created := &dispute{
+		ID:       s.nextID("dp_test"),
+		Object:   "dispute",
+		Amount:   amount,
+		Charge:   intent.LatestCharge.ID,
+		Currency: intent.Currency,
+		Created:  time.Now().Unix(),
+		Evidence: map[string]string{},
+		EvidenceDetails: disputeEvidenceDetails{
+			DueBy: time.Now().Add(disputeResponseWindow).Unix(),
+		},
+		Metadata:      map[string]string{},
+		PaymentIntent: intent.ID,
+		Reason:        reason,
+		Status:        status,
+	}
+	s.disputes[created.ID] = created
+	payloads := [][]byte{s.emit("charge.dispute.created", *created)}
+	s.mu.Unlock()
+
+	s.respondWithDeliveries(w, payloads)
+}
+
+// closeDispute plays the bank deciding a dispute, with an outcome of won or
+// lost. A won inquiry is closed without escalating.
+func (s *Server) closeDispute(w http.ResponseWriter, r *http.Request) {
+	outcome := r.FormValue("outcome")
+
+	s.mu.Lock()
+	found, ok := s.disputes[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		writeNotFound(w, "dispute", r.PathValue("id"))
+		return
+	}
+	inquiry := strings.HasPrefix(found.Status, "warning_")
+	if found.Status == string(stripe.DisputeStatusWon) || found.Status == string(stripe.DisputeStatusLost) || found.Status == string(stripe.DisputeStatusWarningClosed) {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("Dispute %s is already closed as %s", found.ID, found.Status), "")
+		return
+	}
+
+	switch {
+	case outcome == OutcomeWon && inquiry:
+		found.Status = string(stripe.DisputeStatusWarningClosed)
+	case outcome == OutcomeWon:
+		found.Status = string(stripe.DisputeStatusWon)
+	case outcome == OutcomeLost:
+		found.Status = string(stripe.DisputeStatusLost)
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("Unknown outcome %q", outcome), "outcome")
+		return
+	}
+	payloads := [][]byte{s.emit("charge.dispute.closed", *found)}
+	s.mu.Unlock()
+
+	s.respondWithDeliveries(w, payloads)
+}
+
+// intentForSession returns the session's PaymentIntent, creating it on first use
+// as Stripe does when the customer submits the checkout page. Callers must hold
+// s.mu.
+func (s *Server) intentForSession(session *checkoutSession) *paymentIntent {
+	if session.PaymentIntent != nil {
+		return s.intents[*session.PaymentIntent]
+	}
+
+	intent := &paymentIntent{
+		ID:            s.nextID("pi_test"),
+		Object:        "payment_intent",
+		Amount:        session.AmountTotal,
+		CaptureMethod: session.captureMethod,
+		Currency:      session.Currency,
+		Created:       session.Created,
+		Metadata:      session.intentMetadata,
+		Status:        string(stripe.PaymentIntentStatusRequiresPaymentMethod),
+	}
+	s.intents[intent.ID] = intent
+	session.PaymentIntent = &intent.ID
+	return intent
+}
+
+// newCharge creates the card charge of a PaymentIntent, either captured or only
+// authorized until the end of the capture window. Callers must hold s.mu.
+func (s *Server) newCharge(intent *paymentIntent, captured bool) *charge {
+	created := &charge{
+		ID:            s.nextID("ch_test"),
+		Object:        "charge",
+		Amount:        intent.Amount,
+		Captured:      captured,
+		Currency:      intent.Currency,
+		PaymentIntent: intent.ID,
+		PaymentMethodDetails: paymentMethodDetails{
+			Type: "card",
+			Card: cardDetails{Brand: "visa", Last4: "4242"},
+		},
+		Status: "succeeded",
+	}
+	if captured {
+		created.AmountCaptured = intent.Amount
+	} else {
+		created.PaymentMethodDetails.Card.CaptureBefore = time.Now().Add(authorizationWindow).Unix()
+	}
+	return created
+}
+
+// sessionForIntent finds the checkout session a PaymentIntent belongs to.
+// Callers must hold s.mu.
+func (s *Server) sessionForIntent(intentID string) *checkoutSession {
+	for _, session := range s.sessions {
+		if session.PaymentIntent != nil && *session.PaymentIntent == intentID {
+			return session
+		}
+	}
+	return nil
+}
+
+// respondWithDeliveries delivers the events synchronously, so a test can check
+// the service's state as soon as the control call returns.
+func (s *Server) respondWithDeliveries(w http.ResponseWriter, payloads [][]byte) {
+	resp := controlResponse{}
+	for _, payload := range payloads {
+		resp.Events = append(resp.Events, payload)
+		if err := s.deliver(payload); err != nil {
+			resp.DeliveryErrors = append(resp.DeliveryErrors, err.Error())
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
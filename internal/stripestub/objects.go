@@ -0,0 +1,135 @@
+package stripestub
+
+// The objects below carry the subset of fields of their Stripe counterparts that
+// the payment service reads, encoded the way the Stripe API encodes them.
+
+type checkoutSession struct {
+	ID                string            `json:"id"`
+	Object            string            `json:"object"`
+	AmountTotal       int64             `json:"amount_total"`
+	Currency          string            `json:"currency"`
+	ClientReferenceID string            `json:"client_reference_id,omitempty"`
+	Created           int64             `json:"created"`
+	ExpiresAt         int64             `json:"expires_at"`
+	Livemode          bool              `json:"livemode"`
+	Metadata          map[string]string `json:"metadata"`
+	Mode              string            `json:"mode"`
+	PaymentIntent     *string           `json:"payment_intent"`
+	PaymentStatus     string            `json:"payment_status"`
+	Status            string            `json:"status"`
+	SuccessURL        string            `json:"success_url"`
+	URL               *string           `json:"url"`
+
+	// captureMethod and intentMetadata come from payment_intent_data and are
+	// given to the PaymentIntent once the session is paid.
+	captureMethod  string
+	intentMetadata map[string]string
+}
+
+// paymentIntent always embeds its latest charge, as if latest_charge had been
+// expanded.
+type paymentIntent struct {
+	ID                 string            `json:"id"`
+	Object             string            `json:"object"`
+	Amount             int64             `json:"amount"`
+	AmountCapturable   int64             `json:"amount_capturable"`
+	AmountReceived     int64             `json:"amount_received"`
+	CancellationReason *string           `json:"cancellation_reason"`
+	CaptureMethod      string            `json:"capture_method"`
+	Currency           string            `json:"currency"`
+	Created            int64             `json:"created"`
+	LatestCharge       *charge           `json:"latest_charge"`
+	Livemode           bool              `json:"livemode"`
+	Metadata           map[string]string `json:"metadata"`
+	Status             string            `json:"status"`
+}
+
+type charge struct {
+	ID                   string               `json:"id"`
+	Object               string               `json:"object"`
+	Amount               int64                `json:"amount"`
+	AmountCaptured       int64                `json:"amount_captured"`
+	Captured             bool                 `json:"captured"`
+	Currency             string               `json:"currency"`
+	PaymentIntent        string               `json:"payment_intent"`
+	PaymentMethodDetails paymentMethodDetails `json:"payment_method_details"`
+	Status               string               `json:"status"`
+}
+
+type paymentMethodDetails struct {
+	Type string      `json:"type"`
+	Card cardDetails `json:"card"`
+}
+
+type cardDetails struct {
+	Brand         string `json:"brand"`
+	CaptureBefore int64  `json:"capture_before,omitempty"`
+	Last4         string `json:"last4"`
+}
+
+type refund struct {
+	ID            string            `json:"id"`
+	Object        string            `json:"object"`
+	Amount        int64             `json:"amount"`
+	Currency      string            `json:"currency"`
+	Created       int64             `json:"created"`
+	FailureReason string            `json:"failure_reason,omitempty"`
+	Metadata      map[string]string `json:"metadata"`
+	PaymentIntent string            `json:"payment_intent"`
+	Reason        string            `json:"reason,omitempty"`
+	Status        string            `json:"status"`
+}
+
+type dispute struct {
+	ID              string                 `json:"id"`
+	Object          string                 `json:"object"`
+	Amount          int64                  `json:"amount"`
+	Charge          string                 `json:"charge"`
+	Currency        string                 `json:"currency"`
+	Created         int64                  `json:"created"`
+	Evidence        map[string]string      `json:"evidence"`
+	EvidenceDetails disputeEvidenceDetails `json:"evidence_details"`
+	Metadata        map[string]string      `json:"metadata"`
+	PaymentIntent   string                 `json:"payment_intent"`
+	Reason          string                 `json:"reason"`
+	Status          string                 `json:"status"`
+}
+
+type disputeEvidenceDetails struct {
+	DueBy           int64 `json:"due_by"`
+	HasEvidence     bool  `json:"has_evidence"`
+	SubmissionCount int   `json:"submission_count"`
+}
+
+type event struct {
+	ID              string    `json:"id"`
+	Object          string    `json:"object"`
+	APIVersion      string    `json:"api_version"`
+	Created         int64     `json:"created"`
+	Data            eventData `json:"data"`
+	Livemode        bool      `json:"livemode"`
+	PendingWebhooks int       `json:"pending_webhooks"`
+	Type            string    `json:"type"`
+}
+
+type eventData struct {
+	Object interface{} `json:"object"`
+}
+
+type list struct {
+	Object  string      `json:"object"`
+	Data    interface{} `json:"data"`
+	HasMore bool        `json:"has_more"`
+	URL     string      `json:"url"`
+}
+
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+}
@@ -0,0 +1,535 @@
+package stripestub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stripe/stripe-go/v81"
+)
+
+const (
+	// sessionLifetime matches the default lifetime of a Stripe Checkout Session.
+	sessionLifetime = 24 * time.Hour
+	// authorizationWindow matches how long Stripe holds a card authorization.
+	authorizationWindow = 7 * 24 * time.Hour
+	// disputeResponseWindow is how long the merchant has to respond to a dispute.
+	disputeResponseWindow = 7 * 24 * time.Hour
+)
+
+type Config struct {
+	// PublicURL is the base of the checkout page URLs handed out for sessions.
+	PublicURL string
+	// WebhookURL receives the events the stub emits. Events are only stored if
+	// it is empty.
+	WebhookURL string
+	// WebhookSecret signs delivered events, as the whsec_ secret of a Stripe
+	// webhook endpoint would.
+	WebhookSecret string
+	// RefundStatus is the status new refunds start in, succeeded or pending.
+	RefundStatus string
+}
+
+// Server is an in-memory stand-in for the parts of the Stripe API the payment
+// service uses: Checkout Sessions, PaymentIntents, Refunds, Disputes and Events. Point the
+// service at it with STRIPE_API_URL. Endpoints under /_stub/ are not part of
+// Stripe; they play the customer and the card networks, moving objects along and
+// sending the resulting webhook events.
+type Server struct {
+	cfg        Config
+	mux        *http.ServeMux
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	sequence    int
+	sessions    map[string]*checkoutSession
+	intents     map[string]*paymentIntent
+	refunds     map[string]*refund
+	disputes    map[string]*dispute
+	events      []*event
+	idempotency map[string]recordedResponse
+}
+
+type recordedResponse struct {
+	status int
+	body   []byte
+}
+
+func New(cfg Config) *Server {
+	if cfg.RefundStatus == "" {
+		cfg.RefundStatus = string(stripe.RefundStatusSucceeded)
+	}
+
+	s := &Server{
+		cfg:         cfg,
+		mux:         http.NewServeMux(),
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		sessions:    map[string]*checkoutSession{},
+		intents:     map[string]*paymentIntent{},
+		refunds:     map[string]*refund{},
+		disputes:    map[string]*dispute{},
+		idempotency: map[string]recordedResponse{},
+	}
+
+	s.mux.HandleFunc("POST /v1/checkout/sessions", s.idempotent(s.createCheckoutSession))
+	s.mux.HandleFunc("GET /v1/checkout/sessions/{id}", s.getCheckoutSession)
+	s.mux.HandleFunc("POST /v1/checkout/sessions/{id}/expire", s.idempotent(s.expireCheckoutSession))
+	s.mux.HandleFunc("GET /v1/payment_intents/{id}", s.getPaymentIntent)
+	s.mux.HandleFunc("POST /v1/payment_intents/{id}/capture", s.idempotent(s.capturePaymentIntent))
+	s.mux.HandleFunc("POST /v1/payment_intents/{id}/cancel", s.idempotent(s.cancelPaymentIntent))
+	s.mux.HandleFunc("POST /v1/refunds", s.idempotent(s.createRefund))
+	s.mux.HandleFunc("GET /v1/refunds/{id}", s.getRefund)
+	s.mux.HandleFunc("GET /v1/disputes/{id}", s.getDispute)
+	s.mux.HandleFunc("POST /v1/disputes/{id}", s.idempotent(s.updateDispute))
+	s.mux.HandleFunc("GET /v1/events", s.listEvents)
+	s.mux.HandleFunc("GET /v1/events/{id}", s.getEvent)
+
+	s.mux.HandleFunc("POST /_stub/checkout/sessions/{id}/complete", s.completeCheckoutSession)
+	s.mux.HandleFunc("POST /_stub/payment_intents/{id}/settle", s.settlePaymentIntent)
+	s.mux.HandleFunc("POST /_stub/payment_intents/{id}/expire_authorization", s.expireAuthorization)
+	s.mux.HandleFunc("POST /_stub/refunds/{id}/settle", s.settleRefund)
+	s.mux.HandleFunc("POST /_stub/payment_intents/{id}/dispute", s.openDispute)
+	s.mux.HandleFunc("POST /_stub/disputes/{id}/close", s.closeDispute)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) createCheckoutSession(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error(), "")
+		return
+	}
+
+	var amountTotal int64
+	var currency string
+	for i := 0; ; i++ {
+		prefix := fmt.Sprintf("line_items[%d]", i)
+		if _, ok := r.PostForm[prefix+"[quantity]"]; !ok {
+			break
+		}
+
+		quantity, err := strconv.ParseInt(r.PostFormValue(prefix+"[quantity]"), 10, 64)
+		if err != nil || quantity < 1 {
+			writeError(w, http.StatusBadRequest, "parameter_invalid_integer", "Invalid quantity", prefix+"[quantity]")
+			return
+		}
+		unitAmount, err := strconv.ParseInt(r.PostFormValue(prefix+"[price_data][unit_amount]"), 10, 64)
+		if err != nil || unitAmount < 0 {
+			writeError(w, http.StatusBadRequest, "parameter_invalid_integer", "Invalid unit_amount", prefix+"[price_data][unit_amount]")
+			return
+		}
+
+		itemCurrency := r.PostFormValue(prefix + "[price_data][currency]")
+		if currency != "" && itemCurrency != currency {
+			writeError(w, http.StatusBadRequest, "", "All line items must use the same currency", prefix+"[price_data][currency]")
+			return
+		}
+		currency = itemCurrency
+		amountTotal += unitAmount * quantity
+	}
+
+	if currency == "" {
+		writeError(w, http.StatusBadRequest, "parameter_missing", "Missing required param: line_items", "line_items")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID("cs_test")
+	now := time.Now()
+	checkoutURL := strings.TrimRight(s.cfg.PublicURL, "/") + "/pay/" + id
+	session := &checkoutSession{
+		ID:                id,
+		Object:            "checkout.session",
+		AmountTotal:       amountTotal,
+		Currency:          currency,
+		ClientReferenceID: r.PostFormValue("client_reference_id"),
+		Created:           now.Unix(),
+		ExpiresAt:         now.Add(sessionLifetime).Unix(),
+		Metadata:          formMetadata(r.PostForm, "metadata"),
+		Mode:              r.PostFormValue("mode"),
+		PaymentStatus:     "unpaid",
+		Status:            string(stripe.CheckoutSessionStatusOpen),
+		SuccessURL:        r.PostFormValue("success_url"),
+		URL:               &checkoutURL,
+		captureMethod:     r.PostFormValue("payment_intent_data[capture_method]"),
+		intentMetadata:    formMetadata(r.PostForm, "payment_intent_data[metadata]"),
+	}
+	if session.captureMethod == "" {
+		session.captureMethod = string(stripe.PaymentIntentCaptureMethodAutomatic)
+	}
+	s.sessions[id] = session
+
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (s *Server) getCheckoutSession(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[r.PathValue("id")]
+	if !ok {
+		writeNotFound(w, "checkout.session", r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (s *Server) expireCheckoutSession(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[r.PathValue("id")]
+	if !ok {
+		writeNotFound(w, "checkout.session", r.PathValue("id"))
+		return
+	}
+	if session.Status != string(stripe.CheckoutSessionStatusOpen) {
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("Only Checkout Sessions with a status in [\"open\"] can be expired. This Checkout Session has a status of %q.", session.Status), "")
+		return
+	}
+
+	session.Status = string(stripe.CheckoutSessionStatusExpired)
+	session.URL = nil
+	go s.deliver(s.emit("checkout.session.expired", *session))
+
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (s *Server) getPaymentIntent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intent, ok := s.intents[r.PathValue("id")]
+	if !ok {
+		writeNotFound(w, "payment_intent", r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, intent)
+}
+
+func (s *Server) capturePaymentIntent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error(), "")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intent, ok := s.intents[r.PathValue("id")]
+	if !ok {
+		writeNotFound(w, "payment_intent", r.PathValue("id"))
+		return
+	}
+	if intent.Status != string(stripe.PaymentIntentStatusRequiresCapture) {
+		writeError(w, http.StatusBadRequest, "payment_intent_unexpected_state", fmt.Sprintf("This PaymentIntent could not be captured because it has a status of %s. Only a PaymentIntent with one of the following statuses may be captured: requires_capture.", intent.Status), "")
+		return
+	}
+
+	amount := intent.AmountCapturable
+	if value := r.PostFormValue("amount_to_capture"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 || parsed > intent.AmountCapturable {
+			writeError(w, http.StatusBadRequest, "parameter_invalid_integer", "Invalid amount_to_capture", "amount_to_capture")
+			return
+		}
+		amount = parsed
+	}
+
+	intent.Status = string(stripe.PaymentIntentStatusSucceeded)
+	intent.AmountReceived = amount
+	intent.AmountCapturable = 0
+	intent.LatestCharge.Captured = true
+	intent.LatestCharge.AmountCaptured = amount
+	if session := s.sessionForIntent(intent.ID); session != nil {
+		session.PaymentStatus = string(stripe.CheckoutSessionPaymentStatusPaid)
+	}
+	go s.deliver(s.emit("payment_intent.succeeded", *intent))
+
+	writeJSON(w, http.StatusOK, intent)
+}
+
+func (s *Server) cancelPaymentIntent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error(), "")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intent, ok := s.intents[r.PathValue("id")]
+	if !ok {
+		writeNotFound(w, "payment_intent", r.PathValue("id"))
+		return
+	}
+	if intent.Status != string(stripe.PaymentIntentStatusRequiresCapture) && intent.Status != string(stripe.PaymentIntentStatusRequiresPaymentMethod) {
+		writeError(w, http.StatusBadRequest, "payment_intent_unexpected_state", fmt.Sprintf("You cannot cancel this PaymentIntent because it has a status of %s.", intent.Status), "")
+		return
+	}
+
+	s.cancelIntent(intent, r.PostFormValue("cancellation_reason"))
+	go s.deliver(s.emit("payment_intent.canceled", *intent))
+
+	writeJSON(w, http.StatusOK, intent)
+}
+
+// cancelIntent releases the PaymentIntent's authorization. Callers must hold s.mu.
+func (s *Server) cancelIntent(intent *paymentIntent, reason string) {
+	intent.Status = string(stripe.PaymentIntentStatusCanceled)
+	intent.AmountCapturable = 0
+	intent.CancellationReason = nil
+	if reason != "" {
+		intent.CancellationReason = &reason
+	}
+}
+
+func (s *Server) createRefund(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error(), "")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intent, ok := s.intents[r.PostFormValue("payment_intent")]
+	if !ok {
+		writeNotFound(w, "payment_intent", r.PostFormValue("payment_intent"))
+		return
+	}
+	if intent.Status != string(stripe.PaymentIntentStatusSucceeded) {
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("PaymentIntent %s does not have a successful charge to refund.", intent.ID), "payment_intent")
+		return
+	}
+
+	var refunded int64
+	for _, existing := range s.refunds {
+		if existing.PaymentIntent == intent.ID && existing.Status != string(stripe.RefundStatusFailed) && existing.Status != string(stripe.RefundStatusCanceled) {
+			refunded += existing.Amount
+		}
+	}
+
+	amount := intent.AmountReceived - refunded
+	if value := r.PostFormValue("amount"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			writeError(w, http.StatusBadRequest, "parameter_invalid_integer", "Invalid amount", "amount")
+			return
+		}
+		amount = parsed
+	}
+	if amount > intent.AmountReceived-refunded {
+		writeError(w, http.StatusBadRequest, "amount_too_large", fmt.Sprintf("Refund amount (%d) is greater than unrefunded amount on charge (%d)", amount, intent.AmountReceived-refunded), "amount")
+		return
+	}
+
+	created := &refund{
+		ID:            s.nextID("re_test"),
+		Object:        "refund",
+		Amount:        amount,
+		Currency:      intent.Currency,
+		Created:       time.Now().Unix(),
+		Metadata:      formMetadata(r.PostForm, "metadata"),
+		PaymentIntent: intent.ID,
+		Reason:        r.PostFormValue("reason"),
+		Status:        s.cfg.RefundStatus,
+	}
+	s.refunds[created.ID] = created
+	go s.deliver(s.emit("refund.created", *created))
+
+	writeJSON(w, http.StatusOK, created)
+}
+
+func (s *Server) getRefund(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found, ok := s.refunds[r.PathValue("id")]
+	if !ok {
+		writeNotFound(w, "refund", r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, found)
+}
+
+func (s *Server) getDispute(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found, ok := s.disputes[r.PathValue("id")]
+	if !ok {
+		writeNotFound(w, "dispute", r.PathValue("id"))
+		return
+	}
+	writeJSON(w, http.StatusOK, found)
+}
+
+// updateDispute sets evidence on a dispute awaiting a response. As on Stripe,
+// the evidence is submitted unless submit is false, which only stages it.
+func (s *Server) updateDispute(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "", err.Error(), "")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found, ok := s.disputes[r.PathValue("id")]
+	if !ok {
+		writeNotFound(w, "dispute", r.PathValue("id"))
+		return
+	}
+	if found.Status != string(stripe.DisputeStatusNeedsResponse) && found.Status != string(stripe.DisputeStatusWarningNeedsResponse) {
+		writeError(w, http.StatusBadRequest, "", fmt.Sprintf("This dispute is already closed or under review, so its evidence cannot be updated. It has a status of %s.", found.Status), "")
+		return
+	}
+
+	for field, value := range formMetadata(r.PostForm, "evidence") {
+		found.Evidence[field] = value
+		found.EvidenceDetails.HasEvidence = true
+	}
+
+	if r.PostFormValue("submit") != "false" {
+		found.EvidenceDetails.SubmissionCount++
+		if found.Status == string(stripe.DisputeStatusWarningNeedsResponse) {
+			found.Status = string(stripe.DisputeStatusWarningUnderReview)
+		} else {
+			found.Status = string(stripe.DisputeStatusUnderReview)
+		}
+	}
+	go s.deliver(s.emit("charge.dispute.updated", *found))
+
+	writeJSON(w, http.StatusOK, found)
+}
+
+func (s *Server) listEvents(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	eventType := r.URL.Query().Get("type")
+	events := []*event{}
+	// Stripe lists the newest events first.
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if eventType == "" || s.events[i].Type == eventType {
+			events = append(events, s.events[i])
+		}
+	}
+
+	writeJSON(w, http.StatusOK, list{
+		Object: "list",
+		Data:   events,
+		URL:    "/v1/events",
+	})
+}
+
+func (s *Server) getEvent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.events {
+		if stored.ID == r.PathValue("id") {
+			writeJSON(w, http.StatusOK, stored)
+			return
+		}
+	}
+	writeNotFound(w, "event", r.PathValue("id"))
+}
+
+// idempotent replays the recorded response of a POST that carried an
+// Idempotency-Key the stub has already seen.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		key = r.URL.Path + "|" + key
+
+		s.mu.Lock()
+		recorded, ok := s.idempotency[key]
+		s.mu.Unlock()
+		if ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(recorded.status)
+			w.Write(recorded.body)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		s.mu.Lock()
+		s.idempotency[key] = recordedResponse{status: recorder.status, body: recorder.body.Bytes()}
+		s.mu.Unlock()
+	}
+}
+
+// nextID returns a new object ID with the given prefix. Callers must hold s.mu.
+func (s *Server) nextID(prefix string) string {
+	s.sequence++
+	return fmt.Sprintf("%s_%06d", prefix, s.sequence)
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(body []byte) (int, error) {
+	r.body.Write(body)
+	return r.ResponseWriter.Write(body)
+}
+
+// formMetadata collects the prefix[key] parameters of a form-encoded request,
+// such as metadata[key].
+func formMetadata(form url.Values, prefix string) map[string]string {
+	metadata := map[string]string{}
+	for key, values := range form {
+		if strings.HasPrefix(key, prefix+"[") && strings.HasSuffix(key, "]") && len(values) > 0 {
+			metadata[strings.TrimSuffix(strings.TrimPrefix(key, prefix+"["), "]")] = values[0]
+		}
+	}
+	return metadata
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string, param string) {
+	writeJSON(w, status, apiError{Error: apiErrorBody{
+		Type:    "invalid_request_error",
+		Code:    code,
+		Message: message,
+		Param:   param,
+	}})
+}
+
+func writeNotFound(w http.ResponseWriter, object string, id string) {
+	writeError(w, http.StatusNotFound, string(stripe.ErrorCodeResourceMissing), fmt.Sprintf("No such %s: '%s'", object, id), "id")
+}
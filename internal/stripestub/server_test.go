@@ -0,0 +1,177 @@
+package stripestub_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"github.com/PharmaKart/payment-svc/internal/providers"
+	"github.com/PharmaKart/payment-svc/internal/stripestub"
+	"github.com/PharmaKart/payment-svc/pkg/config"
+	"github.com/PharmaKart/payment-svc/pkg/money"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+const webhookSecret = "whsec_stub"
+
+// webhookReceiver checks the signature of the events the stub delivers, as the
+// service's webhook endpoint does, and hands them to the test.
+func webhookReceiver(t *testing.T) (*httptest.Server, <-chan stripe.Event) {
+	t.Helper()
+
+	events := make(chan stripe.Event, 16)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		event, err := webhook.ConstructEventWithOptions(payload, r.Header.Get("Stripe-Signature"), webhookSecret, webhook.ConstructEventOptions{
+			IgnoreAPIVersionMismatch: true,
+		})
+		if err != nil {
+			t.Errorf("webhook with invalid signature: %v", err)
+			http.Error(w, "invalid signature", http.StatusBadRequest)
+			return
+		}
+		events <- event
+	}))
+	t.Cleanup(receiver.Close)
+
+	return receiver, events
+}
+
+func waitForEvent(t *testing.T, events <-chan stripe.Event, eventType stripe.EventType) stripe.Event {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("no %s event was delivered", eventType)
+		}
+	}
+}
+
+func TestStripeClientAgainstStub(t *testing.T) {
+	receiver, events := webhookReceiver(t)
+
+	stub := httptest.NewServer(stripestub.New(stripestub.Config{
+		PublicURL:     "http://checkout.test",
+		WebhookURL:    receiver.URL,
+		WebhookSecret: webhookSecret,
+	}))
+	t.Cleanup(stub.Close)
+
+	provider := providers.NewStripeProvider(providers.NewStripeClient(&config.Config{
+		StripeSecretKey:   "sk_test_stub",
+		StripeAPIURL:      stub.URL,
+		StripeHTTPTimeout: 5 * time.Second,
+	}))
+
+	// Checkout.
+	request := providers.CheckoutSessionRequest{
+		OrderID:  "order",
+		Currency: "cad",
+		LineItems: []providers.LineItem{
+			{Name: "Vitamin D", UnitAmount: money.New(1250, "cad"), Quantity: 2},
+			{Name: "Shipping", UnitAmount: money.New(499, "cad"), Quantity: 1},
+		},
+		SuccessURL:     "http://frontend.test/orders/order",
+		Metadata:       map[string]string{"order_id": "order", "customer_id": "customer"},
+		IdempotencyKey: "checkout:order",
+	}
+	session, err := provider.CreateCheckoutSession(request)
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession: %v", err)
+	}
+	if session.Status != models.CheckoutSessionStatusOpen {
+		t.Errorf("session status = %q, want open", session.Status)
+	}
+	if session.Amount != money.New(2999, "cad") {
+		t.Errorf("session amount = %s, want 29.99 CAD", session.Amount)
+	}
+	if session.URL == "" {
+		t.Error("session has no checkout URL")
+	}
+
+	retried, err := provider.CreateCheckoutSession(request)
+	if err != nil {
+		t.Fatalf("retried CreateCheckoutSession: %v", err)
+	}
+	if retried.ID != session.ID {
+		t.Errorf("retried session = %s, want %s", retried.ID, session.ID)
+	}
+
+	// The customer pays, and the stub delivers a signed webhook.
+	resp, err := http.Post(stub.URL+"/_stub/checkout/sessions/"+session.ID+"/complete", "application/x-www-form-urlencoded", nil)
+	if err != nil {
+		t.Fatalf("completing the session: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("completing the session responded with %s", resp.Status)
+	}
+
+	event := waitForEvent(t, events, stripe.EventTypeCheckoutSessionCompleted)
+	var completed stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &completed); err != nil {
+		t.Fatalf("decoding the event: %v", err)
+	}
+	if completed.ID != session.ID || completed.Metadata["order_id"] != "order" {
+		t.Errorf("event is about session %s of order %q, want %s of order", completed.ID, completed.Metadata["order_id"], session.ID)
+	}
+
+	fetched, err := provider.GetCheckoutSession(session.ID)
+	if err != nil {
+		t.Fatalf("GetCheckoutSession: %v", err)
+	}
+	if fetched.Status != models.CheckoutSessionStatusComplete || fetched.PaymentIntentID == "" {
+		t.Fatalf("session is %q with PaymentIntent %q, want complete with a PaymentIntent", fetched.Status, fetched.PaymentIntentID)
+	}
+
+	intent, err := provider.GetPaymentIntent(fetched.PaymentIntentID)
+	if err != nil {
+		t.Fatalf("GetPaymentIntent: %v", err)
+	}
+	if intent.Status != "succeeded" || intent.AmountReceived != money.New(2999, "cad") {
+		t.Errorf("PaymentIntent is %q with %s received, want succeeded with 29.99 CAD", intent.Status, intent.AmountReceived)
+	}
+
+	// Refund part of it.
+	refund, err := provider.CreateRefund(providers.RefundRequest{
+		PaymentIntentID: intent.ID,
+		Amount:          money.New(1000, "cad"),
+		Reason:          "requested_by_customer",
+		IdempotencyKey:  "refund:order",
+	})
+	if err != nil {
+		t.Fatalf("CreateRefund: %v", err)
+	}
+	if refund.Status != models.RefundStatusSucceeded || refund.Amount != money.New(1000, "cad") {
+		t.Errorf("refund is %q of %s, want succeeded of 10.00 CAD", refund.Status, refund.Amount)
+	}
+
+	event = waitForEvent(t, events, "refund.created")
+	var created stripe.Refund
+	if err := json.Unmarshal(event.Data.Raw, &created); err != nil {
+		t.Fatalf("decoding the event: %v", err)
+	}
+	if created.ID != refund.ID {
+		t.Errorf("refund event is about %s, want %s", created.ID, refund.ID)
+	}
+
+	// More than what is left cannot be refunded.
+	if _, err := provider.CreateRefund(providers.RefundRequest{PaymentIntentID: intent.ID, Amount: money.New(2000, "cad")}); err == nil {
+		t.Error("refunding more than was left succeeded")
+	}
+}
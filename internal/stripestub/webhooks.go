@@ -0,0 +1,70 @@
+package stripestub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/pkg/utils"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+// emit records an event about object and returns its encoded payload. Callers
+// must hold s.mu, and should deliver the payload once they have released it.
+func (s *Server) emit(eventType string, object interface{}) []byte {
+	created := &event{
+		ID:              s.nextID("evt_test"),
+		Object:          "event",
+		APIVersion:      stripe.APIVersion,
+		Created:         time.Now().Unix(),
+		Data:            eventData{Object: object},
+		PendingWebhooks: 1,
+		Type:            eventType,
+	}
+	s.events = append(s.events, created)
+
+	payload, err := json.Marshal(created)
+	if err != nil {
+		// The stub's own objects always encode.
+		panic(err)
+	}
+	return payload
+}
+
+// deliver posts a signed event to the configured webhook URL.
+func (s *Server) deliver(payload []byte) error {
+	if s.cfg.WebhookURL == "" {
+		return nil
+	}
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: payload,
+		Secret:  s.cfg.WebhookSecret,
+	})
+
+	req, err := http.NewRequest(http.MethodPost, s.cfg.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Stripe-Signature", signed.Header)
+
+	resp, err := s.httpClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("webhook endpoint responded with %s", resp.Status)
+		}
+	}
+
+	if err != nil {
+		utils.Warn("Stub failed to deliver webhook event", map[string]interface{}{
+			"url":   s.cfg.WebhookURL,
+			"error": err.Error(),
+		})
+	}
+	return err
+}
@@ -4,16 +4,42 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port            string
-	DBConnString    string
-	OrderServiceURL string
-	StripeSecretKey string
-	FrontendURL     string
+	Port                       string
+	DBConnString               string
+	OrderServiceURL            string
+	PaymentProvider            string
+	FakeProviderOutcome        string
+	StripeSecretKey            string
+	StripeWebhookSecret        string
+	StripeAPIURL               string
+	StripeAPIVersion           string
+	StripeHTTPTimeout          time.Duration
+	StripeMaxNetworkRetries    int64
+	WebhookPort                string
+	WebhookRetryInterval       time.Duration
+	WebhookMaxAttempts         int
+	OutboxDispatchInterval     time.Duration
+	OutboxMaxAttempts          int
+	AuthorizationCheckInterval time.Duration
+	AuthorizationExpiryWarning time.Duration
+	PendingSweepInterval       time.Duration
+	PendingPaymentTimeout      time.Duration
+	JobRunRetention            time.Duration
+	RefundApprovalThresholds   map[string]int64
+	RefundApprovers            []string
+	FrontendURL                string
+	DefaultCurrency            string
+	SupportedCurrencies        []string
+	PayableOrderStatuses       []string
+	PrescriptionPolicyFile     string
 }
 
 // LoadConfig loads configuration from environment variables or a .env file.
@@ -24,11 +50,34 @@ func LoadConfig() *Config {
 	}
 
 	return &Config{
-		Port:            getEnv("PORT", "50054"),
-		DBConnString:    getDBConnString(),
-		OrderServiceURL: getEnv("ORDER_SERVICE_URL", "localhost:50053"),
-		StripeSecretKey: getEnv("STRIPE_SECRET_KEY", "sk_test_4eC39HqLyjWDarjtT1zdp7dc"),
-		FrontendURL:     getEnv("FRONTEND_URL", "http://localhost:3000"),
+		Port:                       getEnv("PORT", "50054"),
+		DBConnString:               getDBConnString(),
+		OrderServiceURL:            getEnv("ORDER_SERVICE_URL", "localhost:50053"),
+		PaymentProvider:            strings.ToLower(getEnv("PAYMENT_PROVIDER", "stripe")),
+		FakeProviderOutcome:        strings.ToLower(getEnv("FAKE_PROVIDER_OUTCOME", "success")),
+		StripeSecretKey:            getEnv("STRIPE_SECRET_KEY", "sk_test_4eC39HqLyjWDarjtT1zdp7dc"),
+		StripeWebhookSecret:        getEnv("STRIPE_WEBHOOK_SECRET", ""),
+		StripeAPIURL:               getEnv("STRIPE_API_URL", ""),
+		StripeAPIVersion:           getEnv("STRIPE_API_VERSION", ""),
+		StripeHTTPTimeout:          getEnvDuration("STRIPE_HTTP_TIMEOUT", 30*time.Second),
+		StripeMaxNetworkRetries:    getEnvInt("STRIPE_MAX_NETWORK_RETRIES", 2),
+		WebhookPort:                getEnv("WEBHOOK_PORT", "8080"),
+		WebhookRetryInterval:       getEnvDuration("WEBHOOK_RETRY_INTERVAL", 30*time.Second),
+		WebhookMaxAttempts:         int(getEnvInt("WEBHOOK_MAX_ATTEMPTS", 15)),
+		OutboxDispatchInterval:     getEnvDuration("OUTBOX_DISPATCH_INTERVAL", 5*time.Second),
+		OutboxMaxAttempts:          int(getEnvInt("OUTBOX_MAX_ATTEMPTS", 20)),
+		AuthorizationCheckInterval: getEnvDuration("AUTHORIZATION_CHECK_INTERVAL", 15*time.Minute),
+		AuthorizationExpiryWarning: getEnvDuration("AUTHORIZATION_EXPIRY_WARNING", 24*time.Hour),
+		PendingSweepInterval:       getEnvDuration("PENDING_SWEEP_INTERVAL", 10*time.Minute),
+		PendingPaymentTimeout:      getEnvDuration("PENDING_PAYMENT_TIMEOUT", 25*time.Hour),
+		JobRunRetention:            getEnvDuration("JOB_RUN_RETENTION", 7*24*time.Hour),
+		RefundApprovalThresholds:   getEnvAmounts("REFUND_APPROVAL_THRESHOLDS", map[string]int64{"cad": 50000, "usd": 50000}),
+		RefundApprovers:            getEnvList("REFUND_APPROVERS", nil),
+		FrontendURL:                getEnv("FRONTEND_URL", "http://localhost:3000"),
+		DefaultCurrency:            strings.ToLower(getEnv("DEFAULT_CURRENCY", "cad")),
+		SupportedCurrencies:        getEnvList("SUPPORTED_CURRENCIES", []string{"cad", "usd"}),
+		PayableOrderStatuses:       getEnvList("PAYABLE_ORDER_STATUSES", []string{"pending", "payment_failed"}),
+		PrescriptionPolicyFile:     getEnv("PRESCRIPTION_POLICY_FILE", ""),
 	}
 }
 
@@ -52,3 +101,55 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvDuration retrieves a duration environment variable (e.g. "30s") or returns a default value.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvInt retrieves a non-negative integer environment variable or returns a default value.
+func getEnvInt(key string, defaultValue int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList retrieves a comma-separated, case-insensitive list environment variable or returns a default value.
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvAmounts retrieves a comma-separated list of non-negative amounts keyed by
+// currency (e.g. "cad:50000,usd:40000") or returns a default value.
+func getEnvAmounts(key string, defaultValue map[string]int64) map[string]int64 {
+	amounts := map[string]int64{}
+	for _, item := range getEnvList(key, nil) {
+		currency, amount, ok := strings.Cut(item, ":")
+		value, err := strconv.ParseInt(strings.TrimSpace(amount), 10, 64)
+		if !ok || err != nil || value < 0 {
+			return defaultValue
+		}
+		amounts[strings.TrimSpace(currency)] = value
+	}
+	if len(amounts) == 0 {
+		return defaultValue
+	}
+	return amounts
+}
@@ -0,0 +1,124 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrCurrencyMismatch is returned when amounts in different currencies are combined.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// zeroDecimalCurrencies have no minor unit, so their amounts are already whole units.
+// See https://docs.stripe.com/currencies#zero-decimal
+var zeroDecimalCurrencies = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true,
+	"krw": true, "mga": true, "pyg": true, "rwf": true, "ugx": true, "vnd": true,
+	"vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// Money is an amount in the minor units of its currency (e.g. cents) together
+// with the lowercase ISO 4217 currency code, matching how Stripe represents amounts.
+type Money struct {
+	Minor    int64  `gorm:"column:minor;not null;default:0"`
+	Currency string `gorm:"column:currency;type:varchar(3);not null;default:'cad'"`
+}
+
+// New creates an amount from minor units.
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: strings.ToLower(currency)}
+}
+
+// FromMajor converts an amount in major units (e.g. dollars) to minor units,
+// rounding half away from zero. The shortest decimal representation of the float
+// is rounded rather than its binary value, so 19.99 becomes 1999 (not 1998) and
+// 1.005 becomes 101 (not 100).
+func FromMajor(major float64, currency string) Money {
+	currency = strings.ToLower(currency)
+
+	value, ok := new(big.Rat).SetString(strconv.FormatFloat(major, 'f', -1, 64))
+	if !ok {
+		// NaN and infinities have no sensible amount.
+		return Money{Currency: currency}
+	}
+	value.Mul(value, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent(currency))), nil)))
+
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(value.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+	}
+
+	return Money{Minor: quotient.Int64(), Currency: currency}
+}
+
+// Major returns the amount in major units. It is only meant for display and for
+// legacy fields; arithmetic should always be done on minor units.
+func (m Money) Major() float64 {
+	return float64(m.Minor) / math.Pow10(exponent(m.Currency))
+}
+
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Minor < 0
+}
+
+// SameCurrency reports whether both amounts are in the same currency.
+func (m Money) SameCurrency(other Money) bool {
+	return m.Currency == other.Currency
+}
+
+// Add returns m + other, failing if the currencies differ.
+func (m Money) Add(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, fmt.Errorf("%w: cannot add %s to %s", ErrCurrencyMismatch, other.Currency, m.Currency)
+	}
+	return Money{Minor: m.Minor + other.Minor, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other, failing if the currencies differ.
+func (m Money) Sub(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, fmt.Errorf("%w: cannot subtract %s from %s", ErrCurrencyMismatch, other.Currency, m.Currency)
+	}
+	return Money{Minor: m.Minor - other.Minor, Currency: m.Currency}, nil
+}
+
+// Mul returns m multiplied by a whole quantity.
+func (m Money) Mul(quantity int64) Money {
+	return Money{Minor: m.Minor * quantity, Currency: m.Currency}
+}
+
+// Cmp compares m to other, returning -1, 0 or 1. It fails if the currencies differ.
+func (m Money) Cmp(other Money) (int, error) {
+	if !m.SameCurrency(other) {
+		return 0, fmt.Errorf("%w: cannot compare %s with %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	switch {
+	case m.Minor < other.Minor:
+		return -1, nil
+	case m.Minor > other.Minor:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// String formats the amount in major units, e.g. "19.99 CAD".
+func (m Money) String() string {
+	return fmt.Sprintf("%.*f %s", exponent(m.Currency), m.Major(), strings.ToUpper(m.Currency))
+}
+
+// exponent returns the number of decimal places of the currency's minor unit.
+// Unknown currencies, including the empty currency, are assumed to use two.
+func exponent(currency string) int {
+	if zeroDecimalCurrencies[currency] {
+		return 0
+	}
+	return 2
+}
@@ -0,0 +1,87 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestFromMajor(t *testing.T) {
+	tests := []struct {
+		name     string
+		major    float64
+		currency string
+		want     Money
+	}{
+		{"whole amount", 20, "cad", Money{Minor: 2000, Currency: "cad"}},
+		{"binary approximation below the decimal", 19.99, "cad", Money{Minor: 1999, Currency: "cad"}},
+		{"half rounds up", 1.005, "cad", Money{Minor: 101, Currency: "cad"}},
+		{"half rounds up again", 2.675, "usd", Money{Minor: 268, Currency: "usd"}},
+		{"below half rounds down", 1.004, "cad", Money{Minor: 100, Currency: "cad"}},
+		{"negative half rounds away from zero", -1.005, "cad", Money{Minor: -101, Currency: "cad"}},
+		{"negative below half rounds towards zero", -1.004, "cad", Money{Minor: -100, Currency: "cad"}},
+		{"zero decimal currency", 1500, "jpy", Money{Minor: 1500, Currency: "jpy"}},
+		{"zero decimal currency half", 0.5, "jpy", Money{Minor: 1, Currency: "jpy"}},
+		{"zero decimal currency negative half", -0.5, "jpy", Money{Minor: -1, Currency: "jpy"}},
+		{"currency is lowercased", 1, "CAD", Money{Minor: 100, Currency: "cad"}},
+		{"zero", 0, "cad", Money{Minor: 0, Currency: "cad"}},
+		{"NaN", math.NaN(), "cad", Money{Minor: 0, Currency: "cad"}},
+		{"infinity", math.Inf(1), "cad", Money{Minor: 0, Currency: "cad"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromMajor(tt.major, tt.currency); got != tt.want {
+				t.Errorf("FromMajor(%v, %q) = %+v, want %+v", tt.major, tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    Money
+		want    Money
+		wantErr error
+	}{
+		{"same currency", New(1999, "cad"), New(1, "cad"), New(2000, "cad"), nil},
+		{"negative amount", New(1999, "cad"), New(-2000, "cad"), New(-1, "cad"), nil},
+		{"zero", New(0, "usd"), New(0, "usd"), New(0, "usd"), nil},
+		{"currency mismatch", New(1999, "cad"), New(1, "usd"), Money{}, ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Add(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("%v.Add(%v) error = %v, want %v", tt.a, tt.b, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("%v.Add(%v) = %+v, want %+v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        Money
+		quantity int64
+		want     Money
+	}{
+		{"single", New(1999, "cad"), 1, New(1999, "cad")},
+		{"several", New(1999, "cad"), 3, New(5997, "cad")},
+		{"zero quantity", New(1999, "cad"), 0, New(0, "cad")},
+		{"negative quantity", New(1999, "usd"), -2, New(-3998, "usd")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.Mul(tt.quantity); got != tt.want {
+				t.Errorf("%v.Mul(%d) = %+v, want %+v", tt.m, tt.quantity, got, tt.want)
+			}
+		})
+	}
+}
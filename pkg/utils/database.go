@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"github.com/PharmaKart/payment-svc/internal/models"
 	"github.com/PharmaKart/payment-svc/pkg/config"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -8,9 +9,41 @@ import (
 
 // ConnectDB connects to the database
 func ConnectDB(cfg *config.Config) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(cfg.DBConnString), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(cfg.DBConnString), &gorm.Config{
+		TranslateError: true,
+	})
 	if err != nil {
 		return nil, err
 	}
 	return db, nil
 }
+
+// MigrateDB creates or updates the tables owned by the payment service
+func MigrateDB(db *gorm.DB) error {
+	if err := db.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`).Error; err != nil {
+		return err
+	}
+
+	err := db.AutoMigrate(
+		&models.Payment{},
+		&models.Refund{},
+		&models.PaymentStatusChange{},
+		&models.WebhookEvent{},
+		&models.OutboxMessage{},
+		&models.IdempotencyKey{},
+		&models.CheckoutSession{},
+		&models.JobLease{},
+		&models.JobRun{},
+		&models.Dispute{},
+		&models.RefundApproval{},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := runMigrations(db); err != nil {
+		return err
+	}
+
+	return syncPaymentConstraints(db)
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PharmaKart/payment-svc/internal/models"
+	"gorm.io/gorm"
+)
+
+// migrationLockID is the Postgres advisory lock key that serializes migrations
+// across replicas starting at the same time.
+const migrationLockID = 5400417
+
+// migration is a one-off schema or data change that AutoMigrate cannot express.
+// Migrations run in order, once, after AutoMigrate has brought the tables up to
+// date with the models.
+type migration struct {
+	ID      string
+	Migrate func(tx *gorm.DB) error
+}
+
+type schemaMigration struct {
+	ID        string    `gorm:"type:varchar(255);primaryKey"`
+	AppliedAt time.Time `gorm:"type:timestamptz;default:now()"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+var migrations = []migration{
+	{ID: "0000_store_amounts_in_minor_units", Migrate: storeAmountsInMinorUnits},
+	{ID: "0001_allow_multiple_payment_attempts", Migrate: allowMultiplePaymentAttempts},
+	{ID: "0002_make_payment_history_immutable", Migrate: makePaymentHistoryImmutable},
+}
+
+func runMigrations(db *gorm.DB) error {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+				return err
+			}
+
+			var applied int64
+			if err := tx.Model(&schemaMigration{}).Where("id = ?", m.ID).Count(&applied).Error; err != nil {
+				return err
+			}
+			if applied > 0 {
+				return nil
+			}
+
+			if err := m.Migrate(tx); err != nil {
+				return err
+			}
+
+			Info("Applied database migration", map[string]interface{}{
+				"migration": m.ID,
+			})
+			return tx.Create(&schemaMigration{ID: m.ID}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storeAmountsInMinorUnits converts the old floating point payments.amount column
+// into amount_minor, rounding half away from zero, and drops it. Casting to
+// numeric first rounds the decimal value that was written rather than its binary
+// approximation.
+func storeAmountsInMinorUnits(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&models.Payment{}, "amount") {
+		return nil
+	}
+
+	err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).
+		Model(&models.Payment{}).
+		UpdateColumn("amount_minor", gorm.Expr("ROUND(amount::numeric * 100)")).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Migrator().DropColumn(&models.Payment{}, "amount")
+}
+
+// allowMultiplePaymentAttempts drops the unique constraint on payments.order_id.
+// Depending on the GORM version that created the table it exists as a constraint
+// or as a unique index.
+func allowMultiplePaymentAttempts(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		"ALTER TABLE payments DROP CONSTRAINT IF EXISTS uni_payments_order_id",
+		"ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_order_id_key",
+		"DROP INDEX IF EXISTS idx_payments_order_id",
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makePaymentHistoryImmutable installs a trigger that rejects updates and deletes
+// on payment_status_changes, so the audit trail cannot be rewritten.
+func makePaymentHistoryImmutable(tx *gorm.DB) error {
+	err := tx.Exec(`
+		CREATE OR REPLACE FUNCTION reject_payment_history_changes() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'payment_status_changes is append-only';
+		END;
+		$$ LANGUAGE plpgsql`).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Exec(`
+		CREATE TRIGGER payment_status_changes_immutable
+		BEFORE UPDATE OR DELETE ON payment_status_changes
+		FOR EACH ROW EXECUTE FUNCTION reject_payment_history_changes()`).Error
+}
+
+// syncPaymentConstraints rebuilds the payments status check constraint and the
+// one-successful-payment-per-order index from the status lists in models, so
+// changing the state machine is all it takes to update the database.
+func syncPaymentConstraints(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec("ALTER TABLE payments DROP CONSTRAINT IF EXISTS chk_payments_status").Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE payments ADD CONSTRAINT chk_payments_status CHECK (status IN (%s))", sqlStringList(models.PaymentStatuses))).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec("DROP INDEX IF EXISTS idx_payments_one_successful_per_order").Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(fmt.Sprintf("CREATE UNIQUE INDEX idx_payments_one_successful_per_order ON payments (order_id) WHERE status IN (%s)", sqlStringList(models.SuccessfulPaymentStatuses))).Error
+	})
+}
+
+// sqlStringList renders constant strings as a SQL list literal. DDL statements
+// cannot take bind parameters, so it must only be used with trusted values.
+func sqlStringList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, fmt.Sprintf("'%s'", strings.ReplaceAll(value, "'", "''")))
+	}
+	return strings.Join(quoted, ", ")
+}